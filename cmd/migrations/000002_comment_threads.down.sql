@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_parent_id_created_at;
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS depth,
+    DROP COLUMN IF EXISTS parent_id;
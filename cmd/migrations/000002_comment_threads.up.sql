@@ -0,0 +1,8 @@
+-- Threaded comments: each comment may reply to another comment on the same post
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES comments(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS depth INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_created_at ON comments(post_id, created_at, id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id_created_at ON comments(parent_id, created_at, id);
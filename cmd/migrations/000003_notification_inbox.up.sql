@@ -0,0 +1,2 @@
+-- Inbox listing: a user's live notifications, newest first
+CREATE INDEX IF NOT EXISTS idx_notifications_inbox ON notifications(user_id, created_at DESC, id DESC) WHERE is_deleted = false;
@@ -0,0 +1,14 @@
+-- Table: mentions
+-- Users referenced as @username in a post or comment
+CREATE TABLE IF NOT EXISTS mentions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subject_type TEXT NOT NULL CHECK (subject_type IN ('post', 'comment')),
+    subject_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mentioned_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (subject_type, subject_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions(user_id);
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username));
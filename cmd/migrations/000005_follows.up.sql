@@ -0,0 +1,12 @@
+-- Table: follows
+-- Directed follow graph: follower_id follows followee_id
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_followee_id ON follows(followee_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_follows_follower_id ON follows(follower_id, created_at DESC);
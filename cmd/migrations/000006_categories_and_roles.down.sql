@@ -0,0 +1,7 @@
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_slug_key;
+ALTER TABLE categories
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS slug;
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
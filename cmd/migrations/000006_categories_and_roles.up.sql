@@ -0,0 +1,27 @@
+-- User roles: admins manage categories, moderators moderate content
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- Category slugs and descriptions
+ALTER TABLE categories
+    ADD COLUMN IF NOT EXISTS slug TEXT,
+    ADD COLUMN IF NOT EXISTS description TEXT,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+
+-- Backfill slugs from names, e.g. "Tech & Science" -> "tech-science"
+UPDATE categories
+SET slug = TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(name, '[^a-zA-Z0-9]+', '-', 'g')))
+WHERE slug IS NULL;
+
+-- Names that slugify to nothing or to an existing slug get an id suffix
+UPDATE categories c
+SET slug = CONCAT_WS('-', NULLIF(c.slug, ''), LEFT(c.id::text, 8))
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY slug ORDER BY created_at, id) AS rn
+    FROM categories
+) d
+WHERE c.id = d.id AND (d.rn > 1 OR c.slug = '');
+
+ALTER TABLE categories ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE categories ADD CONSTRAINT categories_slug_key UNIQUE (slug);
@@ -0,0 +1,4 @@
+-- Post listing filters and sorts
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_post_categories_category_id ON post_categories(category_id);
@@ -0,0 +1,2 @@
+-- Batched comment counts for post listings
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_posts_score;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS reply_count,
+    DROP COLUMN IF EXISTS score,
+    DROP COLUMN IF EXISTS downvotes,
+    DROP COLUMN IF EXISTS upvotes;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS comment_count,
+    DROP COLUMN IF EXISTS score,
+    DROP COLUMN IF EXISTS downvotes,
+    DROP COLUMN IF EXISTS upvotes;
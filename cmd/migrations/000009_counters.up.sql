@@ -0,0 +1,58 @@
+-- Denormalized counters, maintained by the application in the same transaction as the
+-- rows they count. Run the repair-counters command to detect and fix drift.
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS upvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS downvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS score INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS comment_count INT NOT NULL DEFAULT 0;
+
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS upvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS downvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS score INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reply_count INT NOT NULL DEFAULT 0;
+
+-- Backfill from the source tables
+UPDATE posts p
+SET upvotes = v.upvotes, downvotes = v.downvotes, score = v.upvotes - v.downvotes
+FROM (
+    SELECT post_id,
+        COUNT(*) FILTER (WHERE vote_type = 1) AS upvotes,
+        COUNT(*) FILTER (WHERE vote_type = -1) AS downvotes
+    FROM post_votes
+    GROUP BY post_id
+) v
+WHERE p.id = v.post_id;
+
+UPDATE posts p
+SET comment_count = c.count
+FROM (
+    SELECT post_id, COUNT(*) AS count
+    FROM comments
+    WHERE deleted_at IS NULL
+    GROUP BY post_id
+) c
+WHERE p.id = c.post_id;
+
+UPDATE comments c
+SET upvotes = v.upvotes, downvotes = v.downvotes, score = v.upvotes - v.downvotes
+FROM (
+    SELECT comment_id,
+        COUNT(*) FILTER (WHERE vote_type = 1) AS upvotes,
+        COUNT(*) FILTER (WHERE vote_type = -1) AS downvotes
+    FROM comment_votes
+    GROUP BY comment_id
+) v
+WHERE c.id = v.comment_id;
+
+UPDATE comments c
+SET reply_count = r.count
+FROM (
+    SELECT parent_id, COUNT(*) AS count
+    FROM comments
+    WHERE parent_id IS NOT NULL
+    GROUP BY parent_id
+) r
+WHERE c.id = r.parent_id;
+
+CREATE INDEX IF NOT EXISTS idx_posts_score ON posts(score DESC, id DESC);
@@ -0,0 +1,4 @@
+-- Soft-deleted posts would reappear, so remove them for good
+DELETE FROM posts WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_at;
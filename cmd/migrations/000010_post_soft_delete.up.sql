@@ -0,0 +1,3 @@
+-- Soft-deleted posts are hidden from listings and can be restored by their author
+-- until the restore window ends. Moderators remove posts for good with a hard delete.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
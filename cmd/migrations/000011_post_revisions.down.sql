@@ -0,0 +1,3 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS edited_at;
+
+DROP TABLE IF EXISTS post_revisions;
@@ -0,0 +1,14 @@
+-- Earlier versions of edited posts. Revisions are numbered from 1 per post; the post
+-- itself is the revision after the last stored one.
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    revision INT NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT,
+    categories TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (post_id, revision)
+);
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
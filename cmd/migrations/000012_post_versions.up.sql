@@ -0,0 +1,12 @@
+-- Optimistic concurrency control for post updates. A post's version is bumped by every
+-- edit, so it matches the revision number of its current version.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+UPDATE posts p
+SET version = r.count + 1
+FROM (
+    SELECT post_id, COUNT(*) AS count
+    FROM post_revisions
+    GROUP BY post_id
+) r
+WHERE p.id = r.post_id;
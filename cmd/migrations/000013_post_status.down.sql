@@ -0,0 +1,14 @@
+DELETE FROM notifications WHERE type = 'new_post';
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check
+    CHECK (type IN ('post_like', 'comment_like', 'new_comment', 'mention', 'follow'));
+
+-- Unpublished posts would become public, so remove them
+DELETE FROM posts WHERE status <> 'published';
+
+DROP INDEX IF EXISTS idx_posts_publish_at;
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_publish_at_check,
+    DROP COLUMN IF EXISTS publish_at,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,14 @@
+-- Drafts are only visible to their author, scheduled posts are published by the
+-- scheduler once publish_at has passed. Existing posts are published.
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD COLUMN IF NOT EXISTS publish_at TIMESTAMPTZ,
+    ADD CONSTRAINT posts_publish_at_check CHECK (status <> 'scheduled' OR publish_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts(publish_at) WHERE status = 'scheduled';
+
+-- Followers are notified when a post is published
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check
+    CHECK (type IN ('post_like', 'comment_like', 'new_comment', 'mention', 'follow', 'new_post'));
@@ -0,0 +1,17 @@
+-- Full-text search. Posts are written in Indonesian, English or a mix of both, so text
+-- is indexed under both configurations (the indonesian one needs PostgreSQL 13 or later).
+-- Title matches rank above content matches.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('indonesian', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('indonesian', COALESCE(content, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(content, '')), 'B')
+) STORED;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector('indonesian', COALESCE(content, '')) ||
+    to_tsvector('english', COALESCE(content, ''))
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector);
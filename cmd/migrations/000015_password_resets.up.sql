@@ -0,0 +1,10 @@
+-- One pending password reset per user, like email_confirmations. Only a SHA-256 hash
+-- of the token is stored, since a reset token is as good as the password.
+CREATE TABLE IF NOT EXISTS password_resets (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_sent_at TIMESTAMPTZ DEFAULT NOW(),
+    is_stale BOOLEAN DEFAULT FALSE
+);
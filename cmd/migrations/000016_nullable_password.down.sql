@@ -0,0 +1,3 @@
+UPDATE users SET password = 'oauth_no_password' WHERE password IS NULL;
+
+ALTER TABLE users ALTER COLUMN password SET NOT NULL;
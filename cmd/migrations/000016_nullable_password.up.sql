@@ -0,0 +1,5 @@
+-- Accounts created through OAuth have no password until the user sets one. They used
+-- to get a placeholder instead, which email sign-in would compare against.
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
+
+UPDATE users SET password = NULL WHERE password = 'oauth_no_password';
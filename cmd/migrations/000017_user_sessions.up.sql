@@ -0,0 +1,15 @@
+-- Metadata of signed-in sessions, so users can see and revoke them. The session data
+-- itself stays in sessions, keyed by the same token. A signed-in session without a row
+-- here has been revoked; sessions from before this table are signed out on their next request.
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    login_method TEXT NOT NULL,
+    ip TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
@@ -0,0 +1,12 @@
+DELETE FROM login_providers WHERE provider = 'passkey';
+
+ALTER TABLE login_providers
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS sign_count,
+    DROP COLUMN IF EXISTS credential,
+    DROP COLUMN IF EXISTS name;
+
+DROP INDEX IF EXISTS idx_login_providers_passkey_identifier;
+DROP INDEX IF EXISTS idx_login_providers_user_id_provider;
+
+ALTER TABLE login_providers ADD CONSTRAINT login_providers_user_id_provider_key UNIQUE (user_id, provider);
@@ -0,0 +1,15 @@
+-- Passkeys are login providers with provider = 'passkey', one row per credential, so a
+-- user can register several. Other providers stay limited to one per user. identifier
+-- holds the base64url credential ID and credential the rest of the WebAuthn credential.
+ALTER TABLE login_providers DROP CONSTRAINT IF EXISTS login_providers_user_id_provider_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_providers_user_id_provider
+    ON login_providers(user_id, provider) WHERE provider <> 'passkey';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_providers_passkey_identifier
+    ON login_providers(identifier) WHERE provider = 'passkey';
+
+ALTER TABLE login_providers
+    ADD COLUMN IF NOT EXISTS name TEXT,
+    ADD COLUMN IF NOT EXISTS credential JSONB,
+    ADD COLUMN IF NOT EXISTS sign_count BIGINT,
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_login_providers_provider_identifier;
@@ -0,0 +1,4 @@
+-- Identity provider sign ins are looked up by the provider's subject, which belongs to
+-- one user only
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_providers_provider_identifier
+    ON login_providers(provider, identifier) WHERE provider NOT IN ('email', 'passkey');
@@ -0,0 +1,4 @@
+-- Invalid two-factor codes are counted per user rather than per sign in, so signing in
+-- again does not grant more guesses. Too many lock the user's codes until locked_until.
+ALTER TABLE user_totp ADD COLUMN IF NOT EXISTS failed_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE user_totp ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
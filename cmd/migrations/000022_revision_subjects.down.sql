@@ -0,0 +1,9 @@
+DELETE FROM revisions WHERE subject_type <> 'post' OR subject_id NOT IN (SELECT id FROM posts);
+
+ALTER TABLE revisions DROP CONSTRAINT IF EXISTS revisions_subject_revision_key;
+ALTER TABLE revisions DROP COLUMN IF EXISTS subject_type;
+ALTER TABLE revisions RENAME COLUMN subject_id TO post_id;
+ALTER TABLE revisions ADD CONSTRAINT post_revisions_post_id_fkey
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE;
+ALTER TABLE revisions ADD CONSTRAINT post_revisions_post_id_revision_key UNIQUE (post_id, revision);
+ALTER TABLE revisions RENAME TO post_revisions;
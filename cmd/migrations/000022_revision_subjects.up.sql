@@ -0,0 +1,11 @@
+-- Revisions belong to a post or a comment, keyed by subject like mentions, so comments
+-- can keep their earlier versions in the same table.
+ALTER TABLE post_revisions RENAME TO revisions;
+ALTER TABLE revisions RENAME COLUMN post_id TO subject_id;
+ALTER TABLE revisions DROP CONSTRAINT IF EXISTS post_revisions_post_id_fkey;
+ALTER TABLE revisions DROP CONSTRAINT IF EXISTS post_revisions_post_id_revision_key;
+
+ALTER TABLE revisions ADD COLUMN IF NOT EXISTS subject_type TEXT NOT NULL DEFAULT 'post'
+    CHECK (subject_type IN ('post', 'comment'));
+ALTER TABLE revisions ALTER COLUMN subject_type DROP DEFAULT;
+ALTER TABLE revisions ADD CONSTRAINT revisions_subject_revision_key UNIQUE (subject_type, subject_id, revision);
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/internal/counter"
+	"github.com/thediligencedev/betteridn/internal/db"
+)
+
+// repair-counters recomputes the denormalized vote and comment counters of posts and
+// comments from their source tables, printing every counter that had drifted
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report drifted counters without fixing them")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Initialize database
+	pool, err := db.Init(cfg.GetDBConnectionString())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	drifts, err := counter.Repair(context.Background(), pool, !*dryRun)
+	if err != nil {
+		log.Fatalf("Failed to repair counters: %v", err)
+	}
+
+	for _, d := range drifts {
+		log.Printf("%s %s: %s is %d, expected %d", d.Table, d.ID, d.Column, d.Stored, d.Expected)
+	}
+
+	switch {
+	case len(drifts) == 0:
+		log.Println("All counters are consistent")
+	case *dryRun:
+		log.Printf("Found %d drifted counters, run without -dry-run to fix them", len(drifts))
+	default:
+		log.Printf("Fixed %d drifted counters", len(drifts))
+	}
+}
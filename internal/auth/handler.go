@@ -8,6 +8,7 @@ import (
 	"github.com/alexedwards/scs/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
 	"github.com/thediligencedev/betteridn/pkg/response"
 	"github.com/thediligencedev/betteridn/pkg/validator"
 )
@@ -17,6 +18,10 @@ type Handler struct {
 	service        *AuthService
 	sessionManager *scs.SessionManager
 	confService    *ConfirmationService
+	resetService   *PasswordResetService
+	sessions       *SessionService
+	twoFactor      *TwoFactorService
+	passkeys       *PasskeyService
 }
 
 // NewHandler modifies to accept ConfirmationService as well
@@ -24,11 +29,19 @@ func NewHandler(
 	pool *pgxpool.Pool,
 	sessionManager *scs.SessionManager,
 	cs *ConfirmationService,
+	rs *PasswordResetService,
+	sessions *SessionService,
+	twoFactor *TwoFactorService,
+	passkeys *PasskeyService,
 ) *Handler {
 	return &Handler{
 		service:        NewAuthService(pool, cs),
 		sessionManager: sessionManager,
 		confService:    cs,
+		resetService:   rs,
+		sessions:       sessions,
+		twoFactor:      twoFactor,
+		passkeys:       passkeys,
 	}
 }
 
@@ -43,6 +56,44 @@ type SignInRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+type SetPasswordRequest struct {
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// PasskeyRegistrationRequest carries the result of navigator.credentials.create()
+type PasskeyRegistrationRequest struct {
+	Name       string          `json:"name" validate:"max=64"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+// PasskeyLoginRequest carries the result of navigator.credentials.get()
+type PasskeyLoginRequest struct {
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+type RenamePasskeyRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+// TwoFactorCodeRequest carries a code from the authenticator app, or a recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
 // TODO: remove check if r.method for all routes because it has been handled by routes mux handler
 // SignUp -> sign up user, send confirmation
 func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
@@ -98,7 +149,7 @@ func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request) {
 	currentUserID := h.sessionManager.GetString(ctx, "user_id")
 	if currentUserID != "" {
 		// Already logged in
-		err := h.sessionManager.RenewToken(ctx)
+		err := h.sessions.Renew(ctx)
 		if err != nil {
 			log.Printf("Failed to renew session token: %v", err)
 			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
@@ -128,14 +179,36 @@ func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Users with two-factor authentication are only signed in once they enter a code
+	twoFactorEnabled, err := h.twoFactor.IsEnabled(ctx, userID)
+	if err != nil {
+		log.Printf("SignIn error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if twoFactorEnabled {
+		if err := h.twoFactor.Challenge(ctx, userID, models.LoginMethodPassword); err != nil {
+			log.Printf("Failed to start two-factor challenge: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		responseJSON := map[string]interface{}{
+			"message": "two-factor authentication required",
+			"data": map[string]bool{
+				"two_factor_required": true,
+			},
+		}
+		response.RespondWithJSON(w, http.StatusOK, responseJSON)
+		return
+	}
+
 	//  Create session
-	err = h.sessionManager.RenewToken(ctx)
+	err = h.sessions.Start(ctx, r, userID, models.LoginMethodPassword)
 	if err != nil {
-		log.Printf("Failed to create session token: %v", err)
+		log.Printf("Failed to create session: %v", err)
 		response.RespondWithError(w, http.StatusInternalServerError, "failed to create session")
 		return
 	}
-	h.sessionManager.Put(ctx, "user_id", userID.String())
 
 	//  Check if user is confirmed
 	var isConfirmed bool
@@ -167,7 +240,7 @@ func (h *Handler) SignOut(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.sessionManager.Destroy(ctx); err != nil {
+	if err := h.sessions.End(ctx); err != nil {
 		log.Printf("SignOut error: %v", err)
 		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
 		return
@@ -188,10 +261,38 @@ func (h *Handler) GetCurrentSession(w http.ResponseWriter, r *http.Request) {
 		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid user_id session")
+		return
+	}
+
+	hasPassword, err := h.service.HasPassword(ctx, uID)
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+		default:
+			log.Printf("GetCurrentSession error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	twoFactorEnabled, err := h.twoFactor.IsEnabled(ctx, uID)
+	if err != nil {
+		log.Printf("GetCurrentSession error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
 
 	responseJSON := map[string]interface{}{
 		"message": "successfully get current session",
-		"data":    map[string]string{"user_id": userID},
+		"data": map[string]interface{}{
+			"user_id":            userID,
+			"has_password":       hasPassword,
+			"two_factor_enabled": twoFactorEnabled,
+		},
 	}
 	response.RespondWithJSON(w, http.StatusOK, responseJSON)
 }
@@ -259,3 +360,662 @@ func (h *Handler) ResendConfirmation(w http.ResponseWriter, r *http.Request) {
 	responseJSON := map[string]string{"message": "confirmation email resent. check your inbox."}
 	response.RespondWithJSON(w, http.StatusOK, responseJSON)
 }
+
+// ForgotPassword -> POST /api/v1/auth/forgot-password
+// The response is the same whether or not the email belongs to an account.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	if err := h.resetService.RequestReset(r.Context(), req.Email); err != nil {
+		log.Printf("ForgotPassword error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	responseJSON := map[string]string{"message": "if an account exists for this email, a password reset link has been sent"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// ResetPassword -> POST /api/v1/auth/reset-password
+// Sets a new password from an emailed token and signs the user out everywhere else.
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := h.resetService.ResetPassword(ctx, req.Token, req.Password)
+	if err != nil {
+		switch err {
+		case ErrInvalidResetToken:
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("ResetPassword error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if _, err := h.sessions.RevokeOthers(ctx, userID); err != nil {
+		log.Printf("ResetPassword error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	responseJSON := map[string]string{"message": "password reset successfully, please sign in with your new password"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// ChangePassword -> POST /api/v1/auth/change-password
+// Replaces the password after checking the current one, and signs the user out everywhere else.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.ChangePassword(r.Context(), uID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		switch err {
+		case ErrInvalidCurrentPassword:
+			response.RespondWithError(w, http.StatusForbidden, err.Error())
+		case ErrNoPassword:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		default:
+			log.Printf("ChangePassword error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if !h.secureSession(w, r, uID) {
+		return
+	}
+
+	responseJSON := map[string]string{"message": "password changed successfully"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// SetPassword -> POST /api/v1/auth/set-password
+// Gives an account created through OAuth a password, so it can also sign in by email.
+func (h *Handler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	var req SetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.SetPassword(r.Context(), uID, req.NewPassword); err != nil {
+		switch err {
+		case ErrPasswordAlreadySet:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		default:
+			log.Printf("SetPassword error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if !h.secureSession(w, r, uID) {
+		return
+	}
+
+	responseJSON := map[string]string{"message": "password set successfully, you can now also sign in with your email"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetSessions -> GET /api/v1/auth/sessions
+// Lists the signed-in sessions of the current user.
+func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessions.List(r.Context(), uID)
+	if err != nil {
+		log.Printf("GetSessions error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "sessions retrieved successfully",
+		"data":    sessions,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// RevokeSession -> DELETE /api/v1/auth/sessions/{sessionId}
+// Signs one session of the current user out, which may be the current session itself.
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid session ID")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.Revoke(r.Context(), uID, sessionID); err != nil {
+		switch err {
+		case ErrSessionNotFound:
+			response.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			log.Printf("RevokeSession error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]string{"message": "session revoked successfully"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// RevokeOtherSessions -> DELETE /api/v1/auth/sessions
+// Signs the current user out everywhere except the current session.
+func (h *Handler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := h.sessions.RevokeOthers(r.Context(), uID)
+	if err != nil {
+		log.Printf("RevokeOtherSessions error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "signed out of all other sessions",
+		"data": map[string]int{
+			"revoked": count,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// SetupTwoFactor -> POST /api/v1/auth/2fa/setup
+// Generates a TOTP secret for the current user to add to an authenticator app.
+func (h *Handler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	setup, err := h.twoFactor.Setup(r.Context(), uID)
+	if err != nil {
+		switch err {
+		case ErrTwoFactorAlreadyEnabled:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		default:
+			log.Printf("SetupTwoFactor error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "scan the QR code with your authenticator app, then enable two-factor authentication with a code",
+		"data":    setup,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// EnableTwoFactor -> POST /api/v1/auth/2fa/enable
+// Turns two-factor authentication on with a first code and returns the recovery codes.
+func (h *Handler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.twoFactor.Enable(r.Context(), uID, req.Code)
+	if err != nil {
+		switch err {
+		case ErrInvalidTwoFactorCode:
+			response.RespondWithError(w, http.StatusForbidden, err.Error())
+		case ErrTwoFactorNotSetUp, ErrTwoFactorAlreadyEnabled:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("EnableTwoFactor error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "two-factor authentication enabled, store your recovery codes somewhere safe",
+		"data": map[string][]string{
+			"recovery_codes": codes,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// VerifyTwoFactor -> POST /api/v1/auth/2fa/verify
+// Completes a sign in that is waiting for its second factor.
+func (h *Handler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	ctx := r.Context()
+	userID, loginMethod, err := h.twoFactor.Verify(ctx, req.Code)
+	if err != nil {
+		switch err {
+		case ErrInvalidTwoFactorCode, ErrNoTwoFactorChallenge:
+			response.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		case ErrTooManyTwoFactorAttempts:
+			response.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+		default:
+			log.Printf("VerifyTwoFactor error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if err := h.sessions.Start(ctx, r, userID, loginMethod); err != nil {
+		log.Printf("Failed to create session: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "user successfully signed in",
+		"data": map[string]string{
+			"user_id": userID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// DisableTwoFactor -> POST /api/v1/auth/2fa/disable
+// Turns two-factor authentication off, given a code or a recovery code.
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.twoFactor.Disable(r.Context(), uID, req.Code); err != nil {
+		switch err {
+		case ErrInvalidTwoFactorCode:
+			response.RespondWithError(w, http.StatusForbidden, err.Error())
+		case ErrTooManyTwoFactorAttempts:
+			response.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+		case ErrTwoFactorNotEnabled:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("DisableTwoFactor error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]string{"message": "two-factor authentication disabled"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// RegenerateRecoveryCodes -> POST /api/v1/auth/2fa/recovery-codes
+// Replaces the recovery codes of the current user, given a code or a recovery code.
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(r.Context(), uID, req.Code)
+	if err != nil {
+		switch err {
+		case ErrInvalidTwoFactorCode:
+			response.RespondWithError(w, http.StatusForbidden, err.Error())
+		case ErrTooManyTwoFactorAttempts:
+			response.RespondWithError(w, http.StatusTooManyRequests, err.Error())
+		case ErrTwoFactorNotEnabled:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("RegenerateRecoveryCodes error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "recovery codes regenerated, the previous ones no longer work",
+		"data": map[string][]string{
+			"recovery_codes": codes,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// BeginPasskeyRegistration -> POST /api/v1/auth/passkeys/register/begin
+// Returns the options for creating a passkey in the browser.
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	creation, err := h.passkeys.BeginRegistration(r.Context(), uID)
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		default:
+			log.Printf("BeginPasskeyRegistration error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "passkey registration started",
+		"data":    creation,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// FinishPasskeyRegistration -> POST /api/v1/auth/passkeys/register/finish
+// Stores the passkey the browser created.
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	passkey, err := h.passkeys.FinishRegistration(r.Context(), uID, req.Name, req.Credential)
+	if err != nil {
+		switch err {
+		case ErrNoPasskeyCeremony, ErrPasskeyVerificationFailed:
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		case ErrPasskeyAlreadyRegistered:
+			response.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("FinishPasskeyRegistration error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "passkey registered successfully",
+		"data":    passkey,
+	}
+	response.RespondWithJSON(w, http.StatusCreated, responseJSON)
+}
+
+// BeginPasskeyLogin -> POST /api/v1/auth/passkeys/login/begin
+// Returns the options for signing in with a passkey in the browser.
+func (h *Handler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	assertion, err := h.passkeys.BeginLogin(r.Context())
+	if err != nil {
+		log.Printf("BeginPasskeyLogin error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "passkey login started",
+		"data":    assertion,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// FinishPasskeyLogin -> POST /api/v1/auth/passkeys/login/finish
+// Signs in the user whose passkey answered the challenge. Passkeys verify the user
+// themselves, so no two-factor code is asked for.
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := h.passkeys.FinishLogin(ctx, req.Credential)
+	if err != nil {
+		switch err {
+		case ErrNoPasskeyCeremony:
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		case ErrPasskeyVerificationFailed:
+			response.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		default:
+			log.Printf("FinishPasskeyLogin error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if err := h.sessions.Start(ctx, r, userID, models.LoginMethodPasskey); err != nil {
+		log.Printf("Failed to create session: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "user successfully signed in",
+		"data": map[string]string{
+			"user_id": userID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetPasskeys -> GET /api/v1/auth/passkeys
+// Lists the passkeys of the current user.
+func (h *Handler) GetPasskeys(w http.ResponseWriter, r *http.Request) {
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	passkeys, err := h.passkeys.List(r.Context(), uID)
+	if err != nil {
+		log.Printf("GetPasskeys error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	responseJSON := map[string]interface{}{
+		"message": "passkeys retrieved successfully",
+		"data":    passkeys,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// RenamePasskey -> PUT /api/v1/auth/passkeys/{passkeyId}
+func (h *Handler) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := uuid.Parse(r.PathValue("passkeyId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid passkey ID")
+		return
+	}
+
+	var req RenamePasskeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.passkeys.Rename(r.Context(), uID, passkeyID, req.Name); err != nil {
+		switch err {
+		case ErrPasskeyNotFound:
+			response.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			log.Printf("RenamePasskey error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]string{"message": "passkey renamed successfully"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// RemovePasskey -> DELETE /api/v1/auth/passkeys/{passkeyId}
+func (h *Handler) RemovePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := uuid.Parse(r.PathValue("passkeyId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid passkey ID")
+		return
+	}
+
+	uID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.passkeys.Remove(r.Context(), uID, passkeyID); err != nil {
+		switch err {
+		case ErrPasskeyNotFound:
+			response.RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			log.Printf("RemovePasskey error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	responseJSON := map[string]string{"message": "passkey removed successfully"}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// sessionUserID reads the signed-in user's ID from the session,
+// writing an error response and returning false if it is missing or malformed
+func (h *Handler) sessionUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID := h.sessionManager.GetString(r.Context(), "user_id")
+	if userID == "" {
+		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, false
+	}
+	uID, err := uuid.Parse(userID)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid user_id session")
+		return uuid.Nil, false
+	}
+	return uID, true
+}
+
+// secureSession runs after the user's password changed: it signs them out of every other
+// session and gives the current one a new token. It writes an error response and returns
+// false if that fails.
+func (h *Handler) secureSession(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	ctx := r.Context()
+	if _, err := h.sessions.RevokeOthers(ctx, userID); err != nil {
+		log.Printf("RevokeOthers error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return false
+	}
+	if err := h.sessions.Renew(ctx); err != nil {
+		log.Printf("Failed to renew session token: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newSessionContext returns a context carrying a fresh session of sm, as LoadAndSave
+// gives handlers
+func newSessionContext(t *testing.T, sm *scs.SessionManager) context.Context {
+	t.Helper()
+	ctx, err := sm.Load(context.Background(), "")
+	if err != nil {
+		t.Fatalf("failed to load session: %v", err)
+	}
+	return ctx
+}
+
+// createUser inserts a user with a password and a confirmed email
+func createUser(t *testing.T, pool *pgxpool.Pool, username, email string) uuid.UUID {
+	t.Helper()
+	var userID uuid.UUID
+	err := pool.QueryRow(context.Background(), `
+		INSERT INTO users (username, email, password, is_email_confirmed)
+		VALUES ($1, $2, 'hash', true)
+		RETURNING id
+	`, username, email).Scan(&userID)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return userID
+}
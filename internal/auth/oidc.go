@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/pkg/response"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOIDCEmailMissing     = errors.New("identity provider did not share an email address")
+	ErrOIDCEmailNotVerified = errors.New("email is registered but not verified by the identity provider")
+	ErrOIDCIdentityConflict = errors.New("account is linked to another identity at this provider")
+)
+
+// OIDCHandler signs users in through the identity providers in the registry. We do not
+// confirm emails for these users, the provider vouches for them instead.
+type OIDCHandler struct {
+	pool           *pgxpool.Pool
+	sessionManager *scs.SessionManager
+	sessions       *SessionService
+	twoFactor      *TwoFactorService
+	providers      *OIDCRegistry
+	cfg            *config.Config
+}
+
+func NewOIDCHandler(pool *pgxpool.Pool, sessionManager *scs.SessionManager, sessions *SessionService, twoFactor *TwoFactorService, providers *OIDCRegistry, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		pool:           pool,
+		sessionManager: sessionManager,
+		sessions:       sessions,
+		twoFactor:      twoFactor,
+		providers:      providers,
+		cfg:            cfg,
+	}
+}
+
+// GetProviders -> GET /api/v1/auth/providers
+func (oh *OIDCHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	response.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "successfully retrieved identity providers",
+		"data":    oh.providers.List(),
+	})
+}
+
+// Login -> GET /api/v1/auth/oidc/{provider}/login, redirects to the provider
+func (oh *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, err := oh.providers.Get(name)
+	if err != nil {
+		response.RespondWithError(w, http.StatusNotFound, "identity provider not found")
+		return
+	}
+
+	state, err := generateRandomState(16)
+	if err != nil {
+		log.Printf("Error generating random state: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "failed to initiate oauth")
+		return
+	}
+	nonce, err := generateRandomState(16)
+	if err != nil {
+		log.Printf("Error generating nonce: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "failed to initiate oauth")
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.authCodeURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC login error: %v", err)
+		response.RespondWithError(w, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	ctx := r.Context()
+	oh.sessionManager.Put(ctx, "oauth_provider", name)
+	oh.sessionManager.Put(ctx, "oauth_state", state)
+	oh.sessionManager.Put(ctx, "oauth_nonce", nonce)
+	oh.sessionManager.Put(ctx, "oauth_verifier", verifier)
+
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+// Callback -> GET /api/v1/auth/oidc/{provider}/callback, the redirect URL registered at
+// the provider. Users with two-factor authentication are not signed in yet: the redirect
+// to the frontend carries two_factor_required=true and they finish with a code at
+// POST /api/v1/auth/2fa/verify, as after a password sign in.
+func (oh *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	name := r.PathValue("provider")
+	provider, err := oh.providers.Get(name)
+	if err != nil {
+		response.RespondWithError(w, http.StatusNotFound, "identity provider not found")
+		return
+	}
+
+	// Whatever happens next, this sign in attempt is used up
+	sessionProvider := oh.sessionManager.PopString(ctx, "oauth_provider")
+	sessionState := oh.sessionManager.PopString(ctx, "oauth_state")
+	nonce := oh.sessionManager.PopString(ctx, "oauth_nonce")
+	verifier := oh.sessionManager.PopString(ctx, "oauth_verifier")
+
+	queryState := r.URL.Query().Get("state")
+	if sessionProvider != name || sessionState == "" ||
+		subtle.ConstantTimeCompare([]byte(sessionState), []byte(queryState)) != 1 {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid oauth state")
+		return
+	}
+
+	if providerErr := r.URL.Query().Get("error"); providerErr != "" {
+		response.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("sign in was not completed: %s", providerErr))
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		response.RespondWithError(w, http.StatusBadRequest, "missing code in callback")
+		return
+	}
+
+	identity, err := provider.exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		switch err {
+		case ErrInvalidIDToken:
+			response.RespondWithError(w, http.StatusUnauthorized, "invalid id token")
+		default:
+			log.Printf("OIDC exchange error: %v", err)
+			response.RespondWithError(w, http.StatusBadGateway, "failed to complete sign in with identity provider")
+		}
+		return
+	}
+
+	userID, err := oh.findOrCreateUser(ctx, name, identity)
+	if err != nil {
+		switch err {
+		case ErrOIDCEmailMissing:
+			response.RespondWithError(w, http.StatusBadRequest, "identity provider did not share an email address")
+		case ErrOIDCEmailNotVerified:
+			response.RespondWithError(w, http.StatusConflict, "an account with this email already exists; sign in to it another way")
+		case ErrOIDCIdentityConflict:
+			response.RespondWithError(w, http.StatusConflict, "account is already linked to another identity at this provider")
+		default:
+			log.Printf("findOrCreateUser error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "failed to create or find user")
+		}
+		return
+	}
+
+	// Redirect to frontend URL or fallback to /home
+	redirectURL := oh.cfg.FrontendURL
+	if redirectURL == "" {
+		redirectURL = "/home"
+	}
+
+	// The provider only replaces the password, a second factor is still required
+	twoFactorEnabled, err := oh.twoFactor.IsEnabled(ctx, userID)
+	if err != nil {
+		log.Printf("OIDC callback error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if twoFactorEnabled {
+		if err := oh.twoFactor.Challenge(ctx, userID, name); err != nil {
+			log.Printf("Failed to start two-factor challenge: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		http.Redirect(w, r, withQuery(redirectURL, "two_factor_required", "true"), http.StatusSeeOther)
+		return
+	}
+
+	// Renew session token and sign the user in
+	if err := oh.sessions.Start(ctx, r, userID, name); err != nil {
+		log.Printf("Failed to create session: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// withQuery adds key=value to the query of rawURL
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// findOrCreateUser returns the user the identity belongs to. Identities are linked by the
+// provider's subject. An identity new to us is linked to the account with its email if
+// the provider verified that email, and otherwise gets a new account.
+func (oh *OIDCHandler) findOrCreateUser(ctx context.Context, provider string, identity *oidcIdentity) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := oh.pool.QueryRow(ctx, `
+        SELECT user_id FROM login_providers
+        WHERE provider = $1 AND identifier = $2
+    `, provider, identity.Subject).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("failed to find login provider: %w", err)
+	}
+
+	// Google sign ins used to be linked by email, move them over to the subject
+	if provider == "google" && identity.Email != "" && identity.EmailVerified {
+		err = oh.pool.QueryRow(ctx, `
+            UPDATE login_providers SET identifier = $2
+            WHERE provider = 'google' AND lower(identifier) = lower($1)
+            RETURNING user_id
+        `, identity.Email, identity.Subject).Scan(&userID)
+		if err == nil {
+			return userID, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("failed to update google login provider: %w", err)
+		}
+	}
+
+	if identity.Email == "" {
+		return uuid.Nil, ErrOIDCEmailMissing
+	}
+
+	tx, err := oh.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM users WHERE lower(email)=lower($1)`,
+		identity.Email).Scan(&userID)
+	switch {
+	case err == nil:
+		// Anyone can claim an email at some providers, so only a verified one may sign
+		// in to an existing account
+		if !identity.EmailVerified {
+			return uuid.Nil, ErrOIDCEmailNotVerified
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		// New users start without a password until they set one, and their email is
+		// confirmed if the provider verified it
+		username := generateUsername(identity.Username, identity.Name, identity.Email)
+		err = tx.QueryRow(ctx, `
+            INSERT INTO users (username, email, is_email_confirmed)
+            VALUES ($1, $2, $3)
+            RETURNING id
+        `, username, identity.Email, identity.EmailVerified).Scan(&userID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to create new %s user: %w", provider, err)
+		}
+	default:
+		return uuid.Nil, fmt.Errorf("failed to find user by email: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+        INSERT INTO login_providers (user_id, provider, identifier)
+        VALUES ($1, $2, $3)
+        ON CONFLICT DO NOTHING
+    `, userID, provider, identity.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create login provider: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return uuid.Nil, ErrOIDCIdentityConflict
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// generateUsername derives a username from the first of candidates with usable
+// characters, the local part of an email counting as one, plus random digits
+func generateUsername(candidates ...string) string {
+	base := ""
+	for _, candidate := range candidates {
+		candidate, _, _ = strings.Cut(candidate, "@")
+		if base = sanitizeUsername(strings.ToLower(candidate)); base != "" {
+			break
+		}
+	}
+	randDigits := randomDigits(4)
+	return fmt.Sprintf("%s%s", base, randDigits)
+}
+
+func randomDigits(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	for i := 0; i < n; i++ {
+		b[i] = '0' + (b[i] % 10)
+	}
+	return string(b)
+}
+
+func sanitizeUsername(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func generateRandomState(length int) (string, error) {
+	b := make([]byte, length)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"golang.org/x/oauth2"
+)
+
+// providerHTTPTimeout bounds every request made to an identity provider
+const providerHTTPTimeout = 10 * time.Second
+
+var (
+	ErrOIDCProviderNotFound = errors.New("identity provider not found")
+	ErrInvalidIDToken       = errors.New("invalid id token")
+)
+
+// OIDCRegistry holds the identity providers users can sign in with, by name
+type OIDCRegistry struct {
+	providers map[string]*OIDCProvider
+	order     []string
+}
+
+// NewOIDCRegistry sets up the configured providers. Discovery happens on first use, so
+// an identity provider being down does not keep the server from starting.
+func NewOIDCRegistry(cfgs []config.OIDCProvider) *OIDCRegistry {
+	// Discovery and signing key fetches outlive the request that triggers them
+	client := &http.Client{Timeout: providerHTTPTimeout}
+	ctx := oidc.ClientContext(context.Background(), client)
+
+	registry := &OIDCRegistry{providers: map[string]*OIDCProvider{}}
+	for _, cfg := range cfgs {
+		registry.providers[cfg.Name] = &OIDCProvider{cfg: cfg, ctx: ctx}
+		registry.order = append(registry.order, cfg.Name)
+	}
+	return registry
+}
+
+// Get returns the provider called name
+func (reg *OIDCRegistry) Get(name string) (*OIDCProvider, error) {
+	provider, ok := reg.providers[name]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+	return provider, nil
+}
+
+// List returns the providers in the order they were configured
+func (reg *OIDCRegistry) List() []models.AuthProvider {
+	providers := make([]models.AuthProvider, 0, len(reg.order))
+	for _, name := range reg.order {
+		provider := reg.providers[name]
+		providers = append(providers, models.AuthProvider{
+			Name:        name,
+			DisplayName: provider.cfg.DisplayName,
+			LoginURL:    "/api/v1/auth/oidc/" + name + "/login",
+		})
+	}
+	return providers
+}
+
+// OIDCProvider signs users in through an OpenID Connect issuer, verifying the ID token it
+// returns, or through a plain OAuth2 server that has neither discovery nor ID tokens,
+// asking its user info endpoint who signed in
+type OIDCProvider struct {
+	cfg config.OIDCProvider
+	ctx context.Context
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcIdentity is who signed in at a provider. Subject is the provider's stable ID for
+// them; the email can change and is only trusted when EmailVerified.
+type oidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// isOIDC reports whether the provider issues ID tokens
+func (p *OIDCProvider) isOIDC() bool {
+	return p.cfg.Issuer != ""
+}
+
+// config returns the provider's OAuth2 config, running discovery the first time.
+// Failed discovery is retried on the next call.
+func (p *OIDCProvider) config() (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, nil
+	}
+
+	endpoint := oauth2.Endpoint{AuthURL: p.cfg.AuthURL, TokenURL: p.cfg.TokenURL}
+	if p.isOIDC() {
+		provider, err := oidc.NewProvider(p.ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover %s: %w", p.cfg.Issuer, err)
+		}
+		p.provider = provider
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+		endpoint = provider.Endpoint()
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     endpoint,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+	}
+	return p.oauth2, nil
+}
+
+// authCodeURL returns where to send the user to sign in. The PKCE challenge is derived
+// from verifier, and the nonce is only sent to OpenID Connect issuers.
+func (p *OIDCProvider) authCodeURL(state, nonce, verifier string) (string, error) {
+	conf, err := p.config()
+	if err != nil {
+		return "", err
+	}
+
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if p.isOIDC() {
+		opts = append(opts, oidc.Nonce(nonce))
+	}
+	return conf.AuthCodeURL(state, opts...), nil
+}
+
+// exchange redeems the authorization code and returns who signed in. ID tokens must be
+// signed by the issuer, issued to us, unexpired and carry the nonce of this sign in.
+func (p *OIDCProvider) exchange(ctx context.Context, code, verifier, nonce string) (*oidcIdentity, error) {
+	conf, err := p.config()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, &http.Client{Timeout: providerHTTPTimeout})
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	if !p.isOIDC() {
+		return p.fetchUserInfo(ctx, conf, token)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		log.Printf("%s returned no id token", p.cfg.Name)
+		return nil, ErrInvalidIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("%s id token verification failed: %v", p.cfg.Name, err)
+		return nil, ErrInvalidIDToken
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		log.Printf("%s id token nonce mismatch", p.cfg.Name)
+		return nil, ErrInvalidIDToken
+	}
+
+	var claims identityClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id token claims: %w", err)
+	}
+
+	// Some issuers leave the email out of ID tokens and only share it through user info
+	if claims.Email == "" && p.provider.UserInfoEndpoint() != "" {
+		info, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get userinfo: %w", err)
+		}
+		if info.Subject != idToken.Subject {
+			return nil, fmt.Errorf("userinfo subject %q does not match id token subject %q", info.Subject, idToken.Subject)
+		}
+		if err := info.Claims(&claims); err != nil {
+			return nil, fmt.Errorf("failed to decode userinfo claims: %w", err)
+		}
+	}
+
+	identity := claims.identity()
+	identity.Subject = idToken.Subject
+	return identity, nil
+}
+
+// fetchUserInfo asks a plain OAuth2 provider who the token belongs to
+func (p *OIDCProvider) fetchUserInfo(ctx context.Context, conf *oauth2.Config, token *oauth2.Token) (*oidcIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := conf.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get userinfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo response status: %s", resp.Status)
+	}
+
+	var claims identityClaims
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode userinfo: %w", err)
+	}
+
+	identity := claims.identity()
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("userinfo has no sub or id")
+	}
+	return identity, nil
+}
+
+// identityClaims are the claims read from ID tokens and user info responses. Plain
+// OAuth2 providers tend to call the subject "id" and the username "login", like GitHub.
+type identityClaims struct {
+	Subject           string          `json:"sub"`
+	ID                json.RawMessage `json:"id"`
+	Email             string          `json:"email"`
+	EmailVerified     claimBool       `json:"email_verified"`
+	Name              string          `json:"name"`
+	PreferredUsername string          `json:"preferred_username"`
+	Login             string          `json:"login"`
+}
+
+func (c *identityClaims) identity() *oidcIdentity {
+	identity := &oidcIdentity{
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: bool(c.EmailVerified),
+		Name:          c.Name,
+		Username:      c.PreferredUsername,
+	}
+	if identity.Subject == "" {
+		// Numeric IDs are kept as written rather than going through float64
+		var id string
+		if err := json.Unmarshal(c.ID, &id); err != nil && len(c.ID) > 0 && string(c.ID) != "null" {
+			id = string(c.ID)
+		}
+		identity.Subject = id
+	}
+	if identity.Username == "" {
+		identity.Username = c.Login
+	}
+	return identity
+}
+
+// claimBool decodes booleans some providers send as strings, like "true"
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	*b = claimBool(strings.EqualFold(strings.Trim(string(data), `"`), "true"))
+	return nil
+}
@@ -0,0 +1,478 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/internal/testdb"
+	"github.com/thediligencedev/betteridn/pkg/totp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	mockClientID = "betteridn"
+	mockSubject  = "subject-1"
+	mockCode     = "authorization-code"
+	mockToken    = "access-token"
+)
+
+// mockIssuer is an OpenID Connect issuer with discovery, signing keys, a token endpoint
+// that checks PKCE, and user info. The ID tokens it issues carry claims over the standard
+// ones, and are signed with signingKey while key is the one it publishes.
+type mockIssuer struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	key        *rsa.PrivateKey
+	signingKey *rsa.PrivateKey
+	challenge  string
+	nonce      string
+	claims     map[string]interface{}
+	userInfo   map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key := newRSAKey(t)
+	m := &mockIssuer{
+		key:        key,
+		signingKey: key,
+		claims: map[string]interface{}{
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"name":           "Alice",
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("GET /keys", m.keys)
+	mux.HandleFunc("POST /token", m.token)
+	mux.HandleFunc("GET /userinfo", m.userinfo)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// provider returns a provider signing in through the issuer
+func (m *mockIssuer) provider(t *testing.T) *OIDCProvider {
+	t.Helper()
+	provider, err := NewOIDCRegistry([]config.OIDCProvider{{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://localhost:6969/api/v1/auth/oidc/mock/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}}).Get("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// authorize plays the authorization endpoint for a browser sent to authURL: it keeps the
+// PKCE challenge and nonce of the sign in and returns the state to send back
+func (m *mockIssuer) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if method := query.Get("code_challenge_method"); method != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", method)
+	}
+	if query.Get("client_id") != mockClientID {
+		t.Fatalf("client_id = %q, want %q", query.Get("client_id"), mockClientID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.challenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+	return query.Get("state")
+}
+
+// signIn starts a sign in at provider the way Login does and returns its PKCE verifier
+// and nonce
+func (m *mockIssuer) signIn(t *testing.T, provider *OIDCProvider) (verifier, nonce string) {
+	t.Helper()
+	verifier = oauth2.GenerateVerifier()
+	nonce = "nonce-" + verifier[:8]
+	authURL, err := provider.authCodeURL("state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("authCodeURL: %v", err)
+	}
+	m.authorize(t, authURL)
+	return verifier, nonce
+}
+
+func (m *mockIssuer) setClaim(name string, value interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if value == nil {
+		delete(m.claims, name)
+		return
+	}
+	m.claims[name] = value
+}
+
+func (m *mockIssuer) setUserInfo(userInfo map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userInfo = userInfo
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/keys",
+		"userinfo_endpoint":                     m.server.URL + "/userinfo",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) keys(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &m.key.PublicKey,
+		KeyID:     "mock",
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != mockCode {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	// The verifier has to be the one the challenge was derived from
+	hash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(hash[:]) != m.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"PKCE verification failed"}`))
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   m.server.URL,
+		"aud":   mockClientID,
+		"sub":   mockSubject,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": m.nonce,
+	}
+	for name, value := range m.claims {
+		claims[name] = value
+	}
+
+	idToken, err := m.sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": mockToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (m *mockIssuer) sign(claims map[string]interface{}) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: m.signingKey, KeyID: "mock"}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+func (m *mockIssuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer "+mockToken || m.userInfo == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, m.userInfo)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := m.provider(t)
+
+	verifier, nonce := m.signIn(t, provider)
+	identity, err := provider.exchange(context.Background(), mockCode, verifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	want := oidcIdentity{Subject: mockSubject, Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *identity != want {
+		t.Fatalf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCExchangeForwardsPKCEVerifier(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := m.provider(t)
+
+	_, nonce := m.signIn(t, provider)
+	other := oauth2.GenerateVerifier()
+	if _, err := provider.exchange(context.Background(), mockCode, other, nonce); err == nil {
+		t.Fatal("exchange with another sign in's verifier succeeded")
+	}
+}
+
+func TestOIDCExchangeNonceMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := m.provider(t)
+
+	verifier, _ := m.signIn(t, provider)
+	if _, err := provider.exchange(context.Background(), mockCode, verifier, "other-nonce"); err != ErrInvalidIDToken {
+		t.Fatalf("exchange with another nonce = %v, want %v", err, ErrInvalidIDToken)
+	}
+
+	// An ID token without a nonce does not match an empty one either
+	verifier, _ = m.signIn(t, provider)
+	m.setClaim("nonce", "")
+	if _, err := provider.exchange(context.Background(), mockCode, verifier, ""); err != ErrInvalidIDToken {
+		t.Fatalf("exchange without a nonce = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestOIDCExchangeBadSignature(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := m.provider(t)
+	m.mu.Lock()
+	m.signingKey = newRSAKey(t)
+	m.mu.Unlock()
+
+	verifier, nonce := m.signIn(t, provider)
+	if _, err := provider.exchange(context.Background(), mockCode, verifier, nonce); err != ErrInvalidIDToken {
+		t.Fatalf("exchange = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestOIDCExchangeRejectsForeignTokens(t *testing.T) {
+	tests := []struct {
+		claim string
+		value interface{}
+	}{
+		{"aud", "another-client"},
+		{"iss", "https://attacker.example"},
+		{"exp", time.Now().Add(-time.Hour).Unix()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.claim, func(t *testing.T) {
+			m := newMockIssuer(t)
+			provider := m.provider(t)
+			m.setClaim(tt.claim, tt.value)
+
+			verifier, nonce := m.signIn(t, provider)
+			if _, err := provider.exchange(context.Background(), mockCode, verifier, nonce); err != ErrInvalidIDToken {
+				t.Fatalf("exchange = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeUserInfo(t *testing.T) {
+	m := newMockIssuer(t)
+	provider := m.provider(t)
+	m.setClaim("email", nil)
+	m.setClaim("email_verified", nil)
+
+	// Some issuers send email_verified as a string
+	m.setUserInfo(map[string]interface{}{
+		"sub":            mockSubject,
+		"email":          "alice@example.com",
+		"email_verified": "true",
+	})
+	verifier, nonce := m.signIn(t, provider)
+	identity, err := provider.exchange(context.Background(), mockCode, verifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if identity.Subject != mockSubject || identity.Email != "alice@example.com" || !identity.EmailVerified {
+		t.Fatalf("identity = %+v, want the user info email", *identity)
+	}
+
+	// User info about someone else must not fill in the email
+	m.setUserInfo(map[string]interface{}{
+		"sub":            "subject-2",
+		"email":          "mallory@example.com",
+		"email_verified": true,
+	})
+	verifier, nonce = m.signIn(t, provider)
+	if identity, err := provider.exchange(context.Background(), mockCode, verifier, nonce); err == nil {
+		t.Fatalf("exchange with another user info subject = %+v, want an error", *identity)
+	}
+}
+
+func TestOIDCLinksVerifiedEmailsOnly(t *testing.T) {
+	pool := testdb.New(t)
+	oh := &OIDCHandler{pool: pool}
+	ctx := context.Background()
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+
+	m := newMockIssuer(t)
+	provider := m.provider(t)
+	exchange := func() *oidcIdentity {
+		t.Helper()
+		verifier, nonce := m.signIn(t, provider)
+		identity, err := provider.exchange(ctx, mockCode, verifier, nonce)
+		if err != nil {
+			t.Fatalf("exchange: %v", err)
+		}
+		return identity
+	}
+	linked := func() bool {
+		t.Helper()
+		var exists bool
+		err := pool.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM login_providers WHERE provider = 'mock' AND identifier = $1)
+		`, mockSubject).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+
+	// Anyone could have claimed alice's address at the provider
+	m.setClaim("email_verified", false)
+	if _, err := oh.findOrCreateUser(ctx, "mock", exchange()); err != ErrOIDCEmailNotVerified {
+		t.Fatalf("findOrCreateUser with unverified email = %v, want %v", err, ErrOIDCEmailNotVerified)
+	}
+	if linked() {
+		t.Fatal("unverified identity was linked")
+	}
+
+	m.setClaim("email_verified", true)
+	for i := 0; i < 2; i++ {
+		userID, err := oh.findOrCreateUser(ctx, "mock", exchange())
+		if err != nil {
+			t.Fatalf("findOrCreateUser %d: %v", i, err)
+		}
+		if userID != aliceID {
+			t.Fatalf("findOrCreateUser %d = %s, want alice %s", i, userID, aliceID)
+		}
+	}
+	if !linked() {
+		t.Fatal("verified identity was not linked")
+	}
+
+	// Once linked, the subject signs in even after the email changes at the provider
+	m.setClaim("email", "alice@elsewhere.example")
+	m.setClaim("email_verified", false)
+	if userID, err := oh.findOrCreateUser(ctx, "mock", exchange()); err != nil || userID != aliceID {
+		t.Fatalf("findOrCreateUser after email change = %s, %v, want alice %s", userID, err, aliceID)
+	}
+}
+
+func TestOIDCCallbackRequiresTwoFactor(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	twoFactor := NewTwoFactorService(pool, sm)
+	m := newMockIssuer(t)
+
+	registry := NewOIDCRegistry([]config.OIDCProvider{{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://localhost:6969/api/v1/auth/oidc/mock/callback",
+		Scopes:      []string{"openid", "email"},
+	}})
+	oh := NewOIDCHandler(pool, sm, NewSessionService(pool, sm), twoFactor, registry,
+		&config.Config{FrontendURL: "http://localhost:3000/home"})
+
+	userID := createUser(t, pool, "alice", "alice@example.com")
+	ctx := newSessionContext(t, sm)
+	setup, err := twoFactor.Setup(ctx, userID)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := twoFactor.Enable(ctx, userID, code); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+
+	// Sign in at the provider, then come back to the callback with the same session
+	ctx = newSessionContext(t, sm)
+	login := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/mock/login", nil).WithContext(ctx)
+	login.SetPathValue("provider", "mock")
+	w := httptest.NewRecorder()
+	oh.Login(w, login)
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Login status = %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+	state := m.authorize(t, w.Header().Get("Location"))
+
+	query := url.Values{"state": {state}, "code": {mockCode}}
+	callback := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/mock/callback?"+query.Encode(), nil).WithContext(ctx)
+	callback.SetPathValue("provider", "mock")
+	w = httptest.NewRecorder()
+	oh.Callback(w, callback)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Callback status = %d, want %d: %s", w.Code, http.StatusSeeOther, w.Body)
+	}
+	if location := w.Header().Get("Location"); location != "http://localhost:3000/home?two_factor_required=true" {
+		t.Fatalf("Callback redirected to %q, want the two-factor prompt", location)
+	}
+	if sm.Exists(ctx, "user_id") {
+		t.Fatal("Callback signed the user in before the two-factor code")
+	}
+	if got := sm.GetString(ctx, twoFactorLoginMethodKey); got != "mock" {
+		t.Fatalf("pending sign in method = %q, want %q", got, "mock")
+	}
+}
@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/internal/db"
+	"github.com/thediligencedev/betteridn/internal/models"
+)
+
+var (
+	ErrNoPasskeyCeremony         = errors.New("no passkey ceremony in progress, please start again")
+	ErrPasskeyVerificationFailed = errors.New("passkey verification failed")
+	ErrPasskeyAlreadyRegistered  = errors.New("passkey is already registered")
+	ErrPasskeyNotFound           = errors.New("passkey not found")
+)
+
+const (
+	// passkeyCeremonyTimeout is how long the browser has to create or use a passkey
+	passkeyCeremonyTimeout = 5 * time.Minute
+	// defaultPasskeyName names passkeys registered without a name
+	defaultPasskeyName = "Passkey"
+)
+
+// Session keys holding the challenge of a ceremony in progress, as JSON webauthn.SessionData
+const (
+	passkeyRegistrationKey = "passkey_registration"
+	passkeyLoginKey        = "passkey_login"
+)
+
+// passkeyUser is a user as WebAuthn sees them. The user handle is the user's ID.
+type passkeyUser struct {
+	id          uuid.UUID
+	username    string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return u.id[:] }
+func (u *passkeyUser) WebAuthnName() string                       { return u.username }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.username }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// PasskeyService handles passwordless sign in with passkeys. Passkeys are stored as
+// login_providers rows with provider 'passkey', one per credential.
+type PasskeyService struct {
+	pool           *pgxpool.Pool
+	sessionManager *scs.SessionManager
+	webAuthn       *webauthn.WebAuthn
+}
+
+// NewPasskeyService creates a PasskeyService for the relying party in cfg
+func NewPasskeyService(pool *pgxpool.Pool, sessionManager *scs.SessionManager, cfg *config.Config) (*PasskeyService, error) {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: "BetterIDN",
+		RPOrigins:     cfg.WebAuthnRPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTimeout},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn configuration: %w", err)
+	}
+
+	return &PasskeyService{
+		pool:           pool,
+		sessionManager: sessionManager,
+		webAuthn:       webAuthn,
+	}, nil
+}
+
+// BeginRegistration starts registering a new passkey for userID and returns the options
+// for navigator.credentials.create(). The challenge is kept in the request's session.
+func (ps *PasskeyService) BeginRegistration(ctx context.Context, userID uuid.UUID) (*protocol.CredentialCreation, error) {
+	user, err := ps.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, sessionData, err := ps.webAuthn.BeginRegistration(user,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		}),
+		// Stops the same authenticator from being registered twice
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey registration: %w", err)
+	}
+
+	if err := ps.putCeremony(ctx, passkeyRegistrationKey, sessionData); err != nil {
+		return nil, err
+	}
+	return creation, nil
+}
+
+// FinishRegistration verifies the credential the browser created for the challenge from
+// BeginRegistration and stores it as a passkey of userID
+func (ps *PasskeyService) FinishRegistration(ctx context.Context, userID uuid.UUID, name string, response []byte) (*models.Passkey, error) {
+	sessionData, err := ps.takeCeremony(ctx, passkeyRegistrationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := ps.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyVerificationFailed
+	}
+	// Fails as well if the challenge was issued to another user
+	credential, err := ps.webAuthn.CreateCredential(user, *sessionData, parsed)
+	if err != nil {
+		return nil, ErrPasskeyVerificationFailed
+	}
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode credential: %w", err)
+	}
+	if name == "" {
+		name = defaultPasskeyName
+	}
+
+	passkey := models.Passkey{Name: name}
+	err = ps.pool.QueryRow(ctx, `
+		INSERT INTO login_providers (user_id, provider, identifier, name, credential, sign_count)
+		VALUES ($1, 'passkey', $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, encodeCredentialID(credential.ID), name, credentialJSON, int64(credential.Authenticator.SignCount),
+	).Scan(&passkey.ID, &passkey.CreatedAt)
+	if err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, ErrPasskeyAlreadyRegistered
+		}
+		return nil, fmt.Errorf("failed to insert passkey: %w", err)
+	}
+	return &passkey, nil
+}
+
+// BeginLogin starts a passwordless sign in and returns the options for
+// navigator.credentials.get(). Any passkey the browser offers may answer, so the user
+// does not have to be known yet. The challenge is kept in the request's session.
+func (ps *PasskeyService) BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, error) {
+	assertion, sessionData, err := ps.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey login: %w", err)
+	}
+
+	if err := ps.putCeremony(ctx, passkeyLoginKey, sessionData); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishLogin verifies the assertion the browser made for the challenge from BeginLogin
+// and returns the ID of the user whose passkey made it. The caller signs the user in.
+func (ps *PasskeyService) FinishLogin(ctx context.Context, response []byte) (uuid.UUID, error) {
+	sessionData, err := ps.takeCeremony(ctx, passkeyLoginKey)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return uuid.Nil, ErrPasskeyVerificationFailed
+	}
+
+	// The user handle the authenticator returns is the user's ID
+	var user *passkeyUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		user, err = ps.loadUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	_, credential, err := ps.webAuthn.ValidatePasskeyLogin(findUser, *sessionData, parsed)
+	if err != nil {
+		return uuid.Nil, ErrPasskeyVerificationFailed
+	}
+	// A signature counter that went backwards means the passkey may have been copied
+	if credential.Authenticator.CloneWarning {
+		return uuid.Nil, ErrPasskeyVerificationFailed
+	}
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to encode credential: %w", err)
+	}
+
+	// The counter check is repeated here so two sign ins racing with one assertion
+	// cannot both succeed. Authenticators without a counter always report 0.
+	signCount := int64(credential.Authenticator.SignCount)
+	tag, err := ps.pool.Exec(ctx, `
+		UPDATE login_providers
+		SET sign_count = $1, credential = $2, last_used_at = NOW()
+		WHERE provider = 'passkey' AND identifier = $3 AND user_id = $4
+			AND (sign_count < $1 OR $1 = 0)
+	`, signCount, credentialJSON, encodeCredentialID(credential.ID), user.id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return uuid.Nil, ErrPasskeyVerificationFailed
+	}
+	return user.id, nil
+}
+
+// List returns the passkeys of userID, oldest first
+func (ps *PasskeyService) List(ctx context.Context, userID uuid.UUID) ([]models.Passkey, error) {
+	rows, err := ps.pool.Query(ctx, `
+		SELECT id, COALESCE(name, ''), created_at, last_used_at
+		FROM login_providers
+		WHERE user_id = $1 AND provider = 'passkey'
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passkeys: %w", err)
+	}
+	passkeys, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Passkey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan passkeys: %w", err)
+	}
+	return passkeys, nil
+}
+
+// Rename changes the name of one of userID's passkeys
+func (ps *PasskeyService) Rename(ctx context.Context, userID, passkeyID uuid.UUID, name string) error {
+	tag, err := ps.pool.Exec(ctx, `
+		UPDATE login_providers SET name = $1
+		WHERE id = $2 AND user_id = $3 AND provider = 'passkey'
+	`, name, passkeyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to rename passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// Remove deletes one of userID's passkeys, which can then no longer sign in
+func (ps *PasskeyService) Remove(ctx context.Context, userID, passkeyID uuid.UUID) error {
+	tag, err := ps.pool.Exec(ctx, `
+		DELETE FROM login_providers WHERE id = $1 AND user_id = $2 AND provider = 'passkey'
+	`, passkeyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// loadUser returns userID with their passkeys
+func (ps *PasskeyService) loadUser(ctx context.Context, userID uuid.UUID) (*passkeyUser, error) {
+	user := &passkeyUser{id: userID}
+	err := ps.pool.QueryRow(ctx, `
+		SELECT username FROM users WHERE id = $1
+	`, userID).Scan(&user.username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rows, err := ps.pool.Query(ctx, `
+		SELECT credential, sign_count FROM login_providers
+		WHERE user_id = $1 AND provider = 'passkey'
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var credentialJSON []byte
+		var signCount int64
+		if err := rows.Scan(&credentialJSON, &signCount); err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		var credential webauthn.Credential
+		if err := json.Unmarshal(credentialJSON, &credential); err != nil {
+			return nil, fmt.Errorf("failed to decode passkey: %w", err)
+		}
+		// sign_count is authoritative, the copy in credential is only a snapshot
+		credential.Authenticator.SignCount = uint32(signCount)
+		user.credentials = append(user.credentials, credential)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating passkey rows: %w", err)
+	}
+	return user, nil
+}
+
+// putCeremony keeps the challenge of a ceremony in the request's session. The session
+// codec cannot encode the struct itself, so it is stored as JSON.
+func (ps *PasskeyService) putCeremony(ctx context.Context, key string, sessionData *webauthn.SessionData) error {
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to encode passkey session data: %w", err)
+	}
+	ps.sessionManager.Put(ctx, key, data)
+	return nil
+}
+
+// takeCeremony removes the challenge of a ceremony from the request's session and returns
+// it, so every challenge is answered at most once
+func (ps *PasskeyService) takeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	data := ps.sessionManager.PopBytes(ctx, key)
+	if data == nil {
+		return nil, ErrNoPasskeyCeremony
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal(data, &sessionData); err != nil {
+		return nil, ErrNoPasskeyCeremony
+	}
+	if !sessionData.Expires.IsZero() && time.Now().After(sessionData.Expires) {
+		return nil, ErrNoPasskeyCeremony
+	}
+	return &sessionData, nil
+}
+
+// encodeCredentialID returns the form of a credential ID stored as the identifier
+func encodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
@@ -0,0 +1,499 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/google/uuid"
+	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/internal/testdb"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:6969"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator is a passkey held in memory. It answers ceremonies the way a browser
+// and platform authenticator would, with "none" attestation and an ES256 key.
+type softAuthenticator struct {
+	rpID         string
+	origin       string
+	flags        byte
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, userID uuid.UUID) *softAuthenticator {
+	t.Helper()
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		rpID:         testRPID,
+		origin:       testOrigin,
+		flags:        flagUserPresent | flagUserVerified,
+		credentialID: credentialID,
+		key:          newSigningKey(t),
+		userHandle:   userID[:],
+	}
+}
+
+func newSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// create answers a registration challenge, like navigator.credentials.create()
+func (a *softAuthenticator) create(t *testing.T, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	point, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An uncompressed point is 0x04 followed by x and y
+	xy := point.Bytes()[1:]
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: xy[:32],
+		-3: xy[32:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // AAGUID, zero for "none" attestation
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(a.flags|flagAttestedData, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encodeBase64(a.clientData(t, "webauthn.create", challenge)),
+		"attestationObject": encodeBase64(attestationObject),
+	})
+}
+
+// get answers a sign in challenge, like navigator.credentials.get(), counting the use
+func (a *softAuthenticator) get(t *testing.T, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+	a.signCount++
+
+	authenticatorData := a.authenticatorData(a.flags, nil)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authenticatorData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    encodeBase64(clientData),
+		"authenticatorData": encodeBase64(authenticatorData),
+		"signature":         encodeBase64(signature),
+		"userHandle":        encodeBase64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge.String(),
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// credential wraps an authenticator response in the PublicKeyCredential the browser sends
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       encodeBase64(a.credentialID),
+		"rawId":    encodeBase64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	ps, err := NewPasskeyService(pool, sm, &config.Config{WebAuthnRPID: testRPID, WebAuthnRPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("NewPasskeyService: %v", err)
+	}
+	ctx := newSessionContext(t, sm)
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t, aliceID)
+
+	creation, err := ps.BeginRegistration(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	passkey, err := ps.FinishRegistration(ctx, aliceID, "Laptop", authenticator.create(t, creation.Response.Challenge))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if passkey.Name != "Laptop" {
+		t.Errorf("passkey name = %q, want %q", passkey.Name, "Laptop")
+	}
+
+	passkeys, err := ps.List(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(passkeys) != 1 || passkeys[0].ID != passkey.ID {
+		t.Fatalf("List = %+v, want the registered passkey", passkeys)
+	}
+
+	for i := 0; i < 2; i++ {
+		assertion, err := ps.BeginLogin(ctx)
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		userID, err := ps.FinishLogin(ctx, authenticator.get(t, assertion.Response.Challenge))
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if userID != aliceID {
+			t.Fatalf("login %d signed in %s, want %s", i, userID, aliceID)
+		}
+	}
+
+	var signCount int64
+	err = pool.QueryRow(context.Background(), `
+		SELECT sign_count FROM login_providers WHERE id = $1
+	`, passkey.ID).Scan(&signCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signCount != int64(authenticator.signCount) {
+		t.Errorf("sign_count = %d, want %d", signCount, authenticator.signCount)
+	}
+}
+
+func TestPasskeyCeremoniesAreSingleUse(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	ps, err := NewPasskeyService(pool, sm, &config.Config{WebAuthnRPID: testRPID, WebAuthnRPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("NewPasskeyService: %v", err)
+	}
+	ctx := newSessionContext(t, sm)
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t, aliceID)
+
+	if _, err := ps.FinishLogin(ctx, []byte("{}")); err != ErrNoPasskeyCeremony {
+		t.Fatalf("FinishLogin without BeginLogin = %v, want %v", err, ErrNoPasskeyCeremony)
+	}
+
+	creation, err := ps.BeginRegistration(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	registration := authenticator.create(t, creation.Response.Challenge)
+	if _, err := ps.FinishRegistration(ctx, aliceID, "", registration); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if _, err := ps.FinishRegistration(ctx, aliceID, "", registration); err != ErrNoPasskeyCeremony {
+		t.Fatalf("second FinishRegistration = %v, want %v", err, ErrNoPasskeyCeremony)
+	}
+
+	login, err := ps.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	assertion := authenticator.get(t, login.Response.Challenge)
+	if _, err := ps.FinishLogin(ctx, assertion); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if _, err := ps.FinishLogin(ctx, assertion); err != ErrNoPasskeyCeremony {
+		t.Fatalf("second FinishLogin = %v, want %v", err, ErrNoPasskeyCeremony)
+	}
+
+	// An old assertion does not answer a new challenge
+	if _, err := ps.BeginLogin(ctx); err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := ps.FinishLogin(ctx, assertion); err != ErrPasskeyVerificationFailed {
+		t.Fatalf("replayed assertion = %v, want %v", err, ErrPasskeyVerificationFailed)
+	}
+}
+
+func TestPasskeySignCountGoingBackwards(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	ps, err := NewPasskeyService(pool, sm, &config.Config{WebAuthnRPID: testRPID, WebAuthnRPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("NewPasskeyService: %v", err)
+	}
+	ctx := newSessionContext(t, sm)
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t, aliceID)
+
+	creation, err := ps.BeginRegistration(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if _, err := ps.FinishRegistration(ctx, aliceID, "", authenticator.create(t, creation.Response.Challenge)); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	login := func(a *softAuthenticator) error {
+		t.Helper()
+		assertion, err := ps.BeginLogin(ctx)
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		_, err = ps.FinishLogin(ctx, a.get(t, assertion.Response.Challenge))
+		return err
+	}
+
+	authenticator.signCount = 9
+	if err := login(authenticator); err != nil {
+		t.Fatalf("login at 10: %v", err)
+	}
+
+	// A copy of the passkey that was used fewer times, or as many
+	clone := *authenticator
+	for _, count := range []uint32{4, 9} {
+		clone.signCount = count
+		if err := login(&clone); err != ErrPasskeyVerificationFailed {
+			t.Errorf("login at %d after 10 = %v, want %v", count+1, err, ErrPasskeyVerificationFailed)
+		}
+	}
+
+	if err := login(authenticator); err != nil {
+		t.Fatalf("login at 11: %v", err)
+	}
+}
+
+func TestPasskeyRejectedAssertions(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	ps, err := NewPasskeyService(pool, sm, &config.Config{WebAuthnRPID: testRPID, WebAuthnRPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("NewPasskeyService: %v", err)
+	}
+	ctx := newSessionContext(t, sm)
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t, aliceID)
+
+	creation, err := ps.BeginRegistration(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if _, err := ps.FinishRegistration(ctx, aliceID, "", authenticator.create(t, creation.Response.Challenge)); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	unregistered := newSoftAuthenticator(t, aliceID)
+
+	tests := []struct {
+		name     string
+		response func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte
+	}{
+		{"malformed response", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			return []byte("{")
+		}},
+		{"other challenge", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			other, err := protocol.CreateChallenge()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return a.get(t, other)
+		}},
+		{"other origin", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			a.origin = "https://attacker.example"
+			return a.get(t, challenge)
+		}},
+		{"other relying party", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			a.rpID = "attacker.example"
+			return a.get(t, challenge)
+		}},
+		{"user not verified", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			a.flags = flagUserPresent
+			return a.get(t, challenge)
+		}},
+		{"bad signature", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			a.key = newSigningKey(t)
+			return a.get(t, challenge)
+		}},
+		{"unregistered credential", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			return unregistered.get(t, challenge)
+		}},
+		{"unknown user", func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			other := uuid.New()
+			a.userHandle = other[:]
+			return a.get(t, challenge)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion, err := ps.BeginLogin(ctx)
+			if err != nil {
+				t.Fatalf("BeginLogin: %v", err)
+			}
+			_, err = ps.FinishLogin(ctx, tt.response(*authenticator, assertion.Response.Challenge))
+			if err != ErrPasskeyVerificationFailed {
+				t.Fatalf("FinishLogin = %v, want %v", err, ErrPasskeyVerificationFailed)
+			}
+		})
+	}
+
+	assertion, err := ps.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := ps.FinishLogin(ctx, authenticator.get(t, assertion.Response.Challenge)); err != nil {
+		t.Fatalf("login after rejected assertions: %v", err)
+	}
+}
+
+func TestPasskeyRejectedRegistrations(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	ps, err := NewPasskeyService(pool, sm, &config.Config{WebAuthnRPID: testRPID, WebAuthnRPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("NewPasskeyService: %v", err)
+	}
+	ctx := newSessionContext(t, sm)
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+	bobID := createUser(t, pool, "bob", "bob@example.com")
+	authenticator := newSoftAuthenticator(t, aliceID)
+
+	tests := []struct {
+		name     string
+		userID   uuid.UUID
+		response func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte
+	}{
+		{"malformed response", aliceID, func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			return []byte("{")
+		}},
+		{"other origin", aliceID, func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			a.origin = "https://attacker.example"
+			return a.create(t, challenge)
+		}},
+		{"user not verified", aliceID, func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			a.flags = flagUserPresent
+			return a.create(t, challenge)
+		}},
+		{"challenge issued to another user", bobID, func(a softAuthenticator, challenge protocol.URLEncodedBase64) []byte {
+			return a.create(t, challenge)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creation, err := ps.BeginRegistration(ctx, aliceID)
+			if err != nil {
+				t.Fatalf("BeginRegistration: %v", err)
+			}
+			_, err = ps.FinishRegistration(ctx, tt.userID, "", tt.response(*authenticator, creation.Response.Challenge))
+			if err != ErrPasskeyVerificationFailed {
+				t.Fatalf("FinishRegistration = %v, want %v", err, ErrPasskeyVerificationFailed)
+			}
+		})
+	}
+
+	for _, want := range []error{nil, ErrPasskeyAlreadyRegistered} {
+		creation, err := ps.BeginRegistration(ctx, aliceID)
+		if err != nil {
+			t.Fatalf("BeginRegistration: %v", err)
+		}
+		_, err = ps.FinishRegistration(ctx, aliceID, "", authenticator.create(t, creation.Response.Challenge))
+		if err != want {
+			t.Fatalf("FinishRegistration = %v, want %v", err, want)
+		}
+	}
+}
+
+func TestRemovedPasskeyCannotSignIn(t *testing.T) {
+	pool := testdb.New(t)
+	sm := scs.New()
+	ps, err := NewPasskeyService(pool, sm, &config.Config{WebAuthnRPID: testRPID, WebAuthnRPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("NewPasskeyService: %v", err)
+	}
+	ctx := newSessionContext(t, sm)
+	aliceID := createUser(t, pool, "alice", "alice@example.com")
+	authenticator := newSoftAuthenticator(t, aliceID)
+
+	creation, err := ps.BeginRegistration(ctx, aliceID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	passkey, err := ps.FinishRegistration(ctx, aliceID, "", authenticator.create(t, creation.Response.Challenge))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+
+	if err := ps.Remove(ctx, aliceID, passkey.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	assertion, err := ps.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := ps.FinishLogin(ctx, authenticator.get(t, assertion.Response.Challenge)); err != ErrPasskeyVerificationFailed {
+		t.Fatalf("login with removed passkey = %v, want %v", err, ErrPasskeyVerificationFailed)
+	}
+}
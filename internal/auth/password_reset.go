@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/worker"
+	"github.com/thediligencedev/betteridn/pkg/password"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+const (
+	// resetTokenTTL is how long a password reset link stays valid
+	resetTokenTTL = time.Hour
+	// resetResendInterval is the minimum time between two reset emails to the same user
+	resetResendInterval = 5 * time.Minute
+)
+
+// PasswordResetService handles forgotten passwords: it emails a one-time reset link and
+// sets a new password for whoever follows it.
+type PasswordResetService struct {
+	pool        *pgxpool.Pool
+	emailWorker *worker.EmailWorker
+	frontendURL string
+}
+
+// NewPasswordResetService creates a PasswordResetService. Reset links point to the
+// /reset-password page of frontendURL.
+func NewPasswordResetService(pool *pgxpool.Pool, emailWorker *worker.EmailWorker, frontendURL string) *PasswordResetService {
+	return &PasswordResetService{
+		pool:        pool,
+		emailWorker: emailWorker,
+		frontendURL: frontendURL,
+	}
+}
+
+// RequestReset emails a reset link to the user with the given email. It returns nil
+// without sending anything when there is no such user, or when a link was sent less
+// than resetResendInterval ago, so callers cannot tell whether an account exists.
+func (rs *PasswordResetService) RequestReset(ctx context.Context, emailStr string) error {
+	var userID uuid.UUID
+	var userEmail string
+	err := rs.pool.QueryRow(ctx, `
+		SELECT id, email FROM users WHERE LOWER(email) = $1
+	`, strings.ToLower(emailStr)).Scan(&userID, &userEmail)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("error looking up user: %w", err)
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		return err
+	}
+
+	// Replace any earlier token unless one was sent too recently
+	tag, err := rs.pool.Exec(ctx, `
+		INSERT INTO password_resets (user_id, token_hash, expires_at, is_stale, last_sent_at)
+		VALUES ($1, $2, $3, false, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash,
+		    expires_at = EXCLUDED.expires_at,
+		    is_stale = false,
+		    last_sent_at = NOW()
+		WHERE password_resets.is_stale OR password_resets.last_sent_at < $4
+	`, userID, hashResetToken(token), time.Now().Add(resetTokenTTL), time.Now().Add(-resetResendInterval))
+	if err != nil {
+		return fmt.Errorf("failed to insert/update password reset: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	resetLink := strings.TrimRight(rs.frontendURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	bodyHTML := strings.ReplaceAll(`
+<!DOCTYPE html>
+<html>
+  <body>
+    <h2>Reset Your Password</h2>
+    <p>Someone asked to reset the password of your account. Click the link below to choose a new one:</p>
+    <a href="$LINK">Reset Password</a>
+    <p>This link will expire in 1 hour. If you did not ask for this, you can ignore this email.</p>
+  </body>
+</html>
+`, "$LINK", resetLink)
+
+	rs.emailWorker.Enqueue(worker.EmailJob{
+		To:       userEmail,
+		Subject:  "Reset Your Password",
+		BodyHTML: bodyHTML,
+	})
+
+	return nil
+}
+
+// ResetPassword sets a new password for the user a valid reset token was sent to and
+// returns the user's ID. The token can only be used once. Following the emailed link
+// proves the user owns the address, so the email is confirmed as well. Users without a
+// password, like those created through Google, get one this way.
+func (rs *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) (uuid.UUID, error) {
+	tx, err := rs.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the token so two concurrent resets cannot both use it
+	var userID uuid.UUID
+	var userEmail string
+	var expiresAt time.Time
+	var isStale bool
+	err = tx.QueryRow(ctx, `
+		SELECT pr.user_id, u.email, pr.expires_at, pr.is_stale
+		FROM password_resets pr
+		JOIN users u ON pr.user_id = u.id
+		WHERE pr.token_hash = $1
+		FOR UPDATE OF pr
+	`, hashResetToken(token)).Scan(&userID, &userEmail, &expiresAt, &isStale)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrInvalidResetToken
+		}
+		return uuid.Nil, fmt.Errorf("error checking reset token: %w", err)
+	}
+	if isStale || time.Now().After(expiresAt) {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	hashed, err := password.HashPassword(newPassword)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET password = $1, is_email_confirmed = true, updated_at = NOW()
+		WHERE id = $2
+	`, hashed, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// Accounts created through OAuth can sign in by email from now on
+	if err := addEmailLoginProvider(ctx, tx, userID, userEmail); err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_resets SET is_stale = true WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to mark token stale: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
+
+// newResetToken returns a random URL-safe token
+func newResetToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// hashResetToken returns the form of a reset token stored in the database
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
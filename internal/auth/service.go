@@ -3,9 +3,11 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/thediligencedev/betteridn/internal/models"
 	"github.com/thediligencedev/betteridn/pkg/email"
@@ -16,6 +18,11 @@ var (
 	ErrUserAlreadyExists  = errors.New("user already exists")
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrCreateUser         = errors.New("failed to create user")
+	ErrUserNotFound       = errors.New("user not found")
+
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrNoPassword             = errors.New("account has no password, set one first")
+	ErrPasswordAlreadySet     = errors.New("account already has a password, change it instead")
 )
 
 // AuthService defines methods for user authentication.
@@ -108,9 +115,126 @@ func (s *AuthService) SignIn(ctx context.Context, emailStr, plainPassword string
 		return uuid.Nil, ErrInvalidCredentials
 	}
 
+	// Accounts created through OAuth cannot sign in by email until they set a password
+	if user.Password == nil {
+		return uuid.Nil, ErrInvalidCredentials
+	}
+
 	// Compare password
-	if err := password.CheckPassword(user.Password, plainPassword); err != nil {
+	if err := password.CheckPassword(*user.Password, plainPassword); err != nil {
 		return uuid.Nil, ErrInvalidCredentials
 	}
 	return user.ID, nil
 }
+
+// HasPassword reports whether the user can sign in with a password
+func (s *AuthService) HasPassword(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var hasPassword bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT password IS NOT NULL FROM users WHERE id = $1
+	`, userID).Scan(&hasPassword)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, fmt.Errorf("failed to check password: %w", err)
+	}
+	return hasPassword, nil
+}
+
+// ChangePassword replaces the password of a user who has one, after checking currentPassword
+func (s *AuthService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the user so a concurrent change cannot slip in between the check and the update
+	var hashed *string
+	err = tx.QueryRow(ctx, `
+		SELECT password FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&hashed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get password: %w", err)
+	}
+	if hashed == nil {
+		return ErrNoPassword
+	}
+	if err := password.CheckPassword(*hashed, currentPassword); err != nil {
+		return ErrInvalidCurrentPassword
+	}
+
+	newHashed, err := password.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2
+	`, newHashed, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetPassword gives a password to a user who has none, such as an account created through
+// Google, so they can also sign in with their email
+func (s *AuthService) SetPassword(ctx context.Context, userID uuid.UUID, newPassword string) error {
+	hashed, err := password.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var emailStr string
+	err = tx.QueryRow(ctx, `
+		UPDATE users SET password = $1, updated_at = NOW()
+		WHERE id = $2 AND password IS NULL
+		RETURNING email
+	`, hashed, userID).Scan(&emailStr)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Either the user is gone or already has a password
+			if _, err := s.HasPassword(ctx, userID); err != nil {
+				return err
+			}
+			return ErrPasswordAlreadySet
+		}
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	if err := addEmailLoginProvider(ctx, tx, userID, emailStr); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// addEmailLoginProvider records that the user can sign in with their email and password
+func addEmailLoginProvider(ctx context.Context, tx pgx.Tx, userID uuid.UUID, emailStr string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO login_providers (user_id, provider, identifier)
+		VALUES ($1, 'email', $2)
+		ON CONFLICT (user_id, provider) WHERE provider <> 'passkey' DO NOTHING
+	`, userID, emailStr)
+	if err != nil {
+		return fmt.Errorf("failed to add email login provider: %w", err)
+	}
+	return nil
+}
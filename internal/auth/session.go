@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// sessionTouchInterval is how stale last_seen_at may get before a request updates it,
+// so an active session costs one write per interval rather than one per request
+const sessionTouchInterval = time.Minute
+
+// SessionService tracks signed-in sessions in user_sessions alongside the session data
+// scs keeps in sessions. Every sign-in, token renewal and sign-out goes through it.
+type SessionService struct {
+	pool           *pgxpool.Pool
+	sessionManager *scs.SessionManager
+}
+
+func NewSessionService(pool *pgxpool.Pool, sessionManager *scs.SessionManager) *SessionService {
+	return &SessionService{pool: pool, sessionManager: sessionManager}
+}
+
+// Start signs userID in on the request's session: it renews the session token, against
+// session fixation, and records the new session with how the user signed in
+func (ss *SessionService) Start(ctx context.Context, r *http.Request, userID uuid.UUID, loginMethod string) error {
+	oldToken := ss.sessionManager.Token(ctx)
+	if err := ss.sessionManager.RenewToken(ctx); err != nil {
+		return fmt.Errorf("failed to renew session token: %w", err)
+	}
+	ss.sessionManager.Put(ctx, "user_id", userID.String())
+
+	// The session may have belonged to someone else before
+	_, err := ss.pool.Exec(ctx, `
+		WITH previous AS (
+			DELETE FROM user_sessions WHERE token = $1
+		)
+		INSERT INTO user_sessions (user_id, token, login_method, ip, user_agent)
+		VALUES ($2, $3, $4, $5, $6)
+	`, oldToken, userID, ss.sessionManager.Token(ctx), loginMethod, clientIP(r), r.UserAgent())
+	if err != nil {
+		return fmt.Errorf("failed to record session: %w", err)
+	}
+	return nil
+}
+
+// Renew gives the request's session a new token, keeping its metadata
+func (ss *SessionService) Renew(ctx context.Context) error {
+	oldToken := ss.sessionManager.Token(ctx)
+	if err := ss.sessionManager.RenewToken(ctx); err != nil {
+		return fmt.Errorf("failed to renew session token: %w", err)
+	}
+
+	_, err := ss.pool.Exec(ctx, `
+		UPDATE user_sessions SET token = $1, last_seen_at = NOW() WHERE token = $2
+	`, ss.sessionManager.Token(ctx), oldToken)
+	if err != nil {
+		return fmt.Errorf("failed to update session token: %w", err)
+	}
+	return nil
+}
+
+// End signs the request's session out
+func (ss *SessionService) End(ctx context.Context) error {
+	_, err := ss.pool.Exec(ctx, `
+		DELETE FROM user_sessions WHERE token = $1
+	`, ss.sessionManager.Token(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	if err := ss.sessionManager.Destroy(ctx); err != nil {
+		return fmt.Errorf("failed to destroy session: %w", err)
+	}
+	return nil
+}
+
+// Touch runs on every request. For a signed-in session it records the activity, at
+// most once per sessionTouchInterval, and it signs out sessions that were revoked,
+// leaving the request to continue anonymously.
+func (ss *SessionService) Touch(ctx context.Context, r *http.Request) error {
+	userID := ss.sessionManager.GetString(ctx, "user_id")
+	if userID == "" {
+		return nil
+	}
+
+	var id uuid.UUID
+	var ownerID string
+	var lastSeenAt time.Time
+	err := ss.pool.QueryRow(ctx, `
+		SELECT id, user_id::text, last_seen_at FROM user_sessions WHERE token = $1
+	`, ss.sessionManager.Token(ctx)).Scan(&id, &ownerID, &lastSeenAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if errors.Is(err, pgx.ErrNoRows) || ownerID != userID {
+		if err := ss.sessionManager.Destroy(ctx); err != nil {
+			return fmt.Errorf("failed to destroy revoked session: %w", err)
+		}
+		return nil
+	}
+
+	if time.Since(lastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+	_, err = ss.pool.Exec(ctx, `
+		UPDATE user_sessions SET last_seen_at = NOW(), ip = $1, user_agent = $2 WHERE id = $3
+	`, clientIP(r), r.UserAgent(), id)
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+// List returns the live sessions of userID, most recently active first, marking the
+// request's own session as current
+func (ss *SessionService) List(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	// Sessions scs expired leave their metadata behind; the grace period spares sessions
+	// signed in or renewed during a request that has not saved its session data yet
+	_, err := ss.pool.Exec(ctx, `
+		DELETE FROM user_sessions us
+		WHERE us.user_id = $1
+			AND us.last_seen_at < NOW() - INTERVAL '1 hour'
+			AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.token = us.token AND s.expiry > NOW())
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	rows, err := ss.pool.Query(ctx, `
+		SELECT us.id, us.login_method, COALESCE(us.ip, ''), COALESCE(us.user_agent, ''),
+			us.created_at, us.last_seen_at, us.token = $2
+		FROM user_sessions us
+		JOIN sessions s ON s.token = us.token
+		WHERE us.user_id = $1 AND s.expiry > NOW()
+		ORDER BY us.last_seen_at DESC, us.id
+	`, userID, ss.sessionManager.Token(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	sessions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.Session])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Revoke signs out one session of userID. Revoking the request's own session is signing out.
+func (ss *SessionService) Revoke(ctx context.Context, userID, sessionID uuid.UUID) error {
+	var token string
+	err := ss.pool.QueryRow(ctx, `
+		SELECT token FROM user_sessions WHERE id = $1 AND user_id = $2
+	`, sessionID, userID).Scan(&token)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if token == ss.sessionManager.Token(ctx) {
+		return ss.End(ctx)
+	}
+	_, err = ss.revoke(ctx, userID, token, "")
+	return err
+}
+
+// RevokeOthers signs out every session of userID except the request's own, and returns
+// how many it signed out. It is the path for "sign out everywhere else" and for every
+// password change.
+func (ss *SessionService) RevokeOthers(ctx context.Context, userID uuid.UUID) (int, error) {
+	return ss.revoke(ctx, userID, "", ss.sessionManager.Token(ctx))
+}
+
+// revoke deletes the sessions of userID with the given token, or all but keepToken when
+// token is empty, together with their session data
+func (ss *SessionService) revoke(ctx context.Context, userID uuid.UUID, token, keepToken string) (int, error) {
+	var count int
+	err := ss.pool.QueryRow(ctx, `
+		WITH revoked AS (
+			DELETE FROM user_sessions
+			WHERE user_id = $1 AND ($2::text = '' OR token = $2) AND token <> $3
+			RETURNING token
+		), destroyed AS (
+			DELETE FROM sessions WHERE token IN (SELECT token FROM revoked)
+		)
+		SELECT COUNT(*) FROM revoked
+	`, userID, token, keepToken).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return count, nil
+}
+
+// clientIP returns the IP address the request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
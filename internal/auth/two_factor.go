@@ -0,0 +1,443 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/pkg/totp"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp        = errors.New("two-factor authentication has not been set up")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor code")
+	ErrNoTwoFactorChallenge     = errors.New("no pending two-factor sign in, please sign in again")
+	ErrTooManyTwoFactorAttempts = errors.New("too many invalid codes, please try again later")
+)
+
+const (
+	// twoFactorIssuer names the account in authenticator apps
+	twoFactorIssuer = "BetterIDN"
+	// twoFactorChallengeTTL is how long a user has to enter a code after their password
+	twoFactorChallengeTTL = 5 * time.Minute
+	// twoFactorMaxAttempts is how many invalid codes in a row lock a user's codes
+	twoFactorMaxAttempts = 5
+	// twoFactorLockout is how long codes are refused after too many invalid ones
+	twoFactorLockout = 15 * time.Minute
+	// totpSkew is how many time steps a code may be off, for clocks that drift
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+	// qrCodeSize is the width of the enrollment QR code in pixels
+	qrCodeSize = 256
+)
+
+// Session keys of a sign in waiting for its second factor. user_id is only set once it passes.
+const (
+	twoFactorUserIDKey      = "two_factor_user_id"
+	twoFactorLoginMethodKey = "two_factor_login_method"
+	twoFactorExpiresAtKey   = "two_factor_expires_at"
+)
+
+// TwoFactorService handles TOTP two-factor authentication: enrollment, recovery codes and
+// the second step of signing in.
+type TwoFactorService struct {
+	pool           *pgxpool.Pool
+	sessionManager *scs.SessionManager
+	// now is the clock codes and pending sign ins are checked against
+	now func() time.Time
+}
+
+func NewTwoFactorService(pool *pgxpool.Pool, sessionManager *scs.SessionManager) *TwoFactorService {
+	return &TwoFactorService{
+		pool:           pool,
+		sessionManager: sessionManager,
+		now:            time.Now,
+	}
+}
+
+// IsEnabled reports whether signing in as userID takes a second factor
+func (ts *TwoFactorService) IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var enabled bool
+	err := ts.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+	`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+	return enabled, nil
+}
+
+// Setup generates a new TOTP secret for userID. Two-factor authentication stays off until
+// Enable confirms the user's authenticator produces matching codes; calling Setup again
+// before that replaces the secret.
+func (ts *TwoFactorService) Setup(ctx context.Context, userID uuid.UUID) (*models.TwoFactorSetup, error) {
+	var userEmail string
+	err := ts.pool.QueryRow(ctx, `
+		SELECT email FROM users WHERE id = $1
+	`, userID).Scan(&userEmail)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := ts.pool.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert/update totp secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	uri := totp.URI(twoFactorIssuer, userEmail, secret)
+	png, err := totp.QRCode(uri, qrCodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorSetup{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// Enable turns two-factor authentication on once code matches the secret from Setup,
+// and returns the user's recovery codes. They are not stored and cannot be shown again.
+func (ts *TwoFactorService) Enable(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	tx, err := ts.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var secret string
+	var enabledAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT secret, enabled_at FROM user_totp WHERE user_id = $1 FOR UPDATE
+	`, userID).Scan(&secret, &enabledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTwoFactorNotSetUp
+		}
+		return nil, fmt.Errorf("failed to get totp secret: %w", err)
+	}
+	if enabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	now := ts.now()
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), now, totpSkew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE user_totp SET enabled_at = $1, last_used_step = $2 WHERE user_id = $3
+	`, now, step, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off, given a current code or a recovery code
+func (ts *TwoFactorService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	tx, err := ts.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := ts.verifyCode(ctx, tx, userID, code); err != nil {
+		return commitFailedAttempt(ctx, tx, err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete totp secret: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of userID, used or not, given a
+// current code or a recovery code, and returns the new ones
+func (ts *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	tx, err := ts.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := ts.verifyCode(ctx, tx, userID, code); err != nil {
+		return nil, commitFailedAttempt(ctx, tx, err)
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// Challenge puts the request's session in the pending state of a sign in that passed its
+// first factor, loginMethod, and now waits for a code. The session token is renewed, as
+// it will be once the user is signed in.
+func (ts *TwoFactorService) Challenge(ctx context.Context, userID uuid.UUID, loginMethod string) error {
+	if err := ts.sessionManager.RenewToken(ctx); err != nil {
+		return fmt.Errorf("failed to renew session token: %w", err)
+	}
+	ts.sessionManager.Put(ctx, twoFactorUserIDKey, userID.String())
+	ts.sessionManager.Put(ctx, twoFactorLoginMethodKey, loginMethod)
+	// Stored as Unix seconds, since the session codec cannot encode a time.Time
+	ts.sessionManager.Put(ctx, twoFactorExpiresAtKey, ts.now().Add(twoFactorChallengeTTL).Unix())
+	return nil
+}
+
+// Verify completes the pending sign in of the request's session with a current code or a
+// recovery code, and returns who signed in and how. The caller signs the user in. After
+// twoFactorChallengeTTL the user has to start over, and after twoFactorMaxAttempts invalid
+// codes, from any session, they have to wait out twoFactorLockout first.
+func (ts *TwoFactorService) Verify(ctx context.Context, code string) (uuid.UUID, string, error) {
+	userID, err := uuid.Parse(ts.sessionManager.GetString(ctx, twoFactorUserIDKey))
+	if err != nil {
+		return uuid.Nil, "", ErrNoTwoFactorChallenge
+	}
+	if ts.now().Unix() >= ts.sessionManager.GetInt64(ctx, twoFactorExpiresAtKey) {
+		ts.clearChallenge(ctx)
+		return uuid.Nil, "", ErrNoTwoFactorChallenge
+	}
+
+	tx, err := ts.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = ts.verifyCode(ctx, tx, userID, code)
+	switch err {
+	case nil:
+	case ErrInvalidTwoFactorCode:
+		return uuid.Nil, "", commitFailedAttempt(ctx, tx, err)
+	case ErrTooManyTwoFactorAttempts:
+		ts.clearChallenge(ctx)
+		return uuid.Nil, "", commitFailedAttempt(ctx, tx, err)
+	case ErrTwoFactorNotEnabled:
+		// Turned off since the password was checked
+		ts.clearChallenge(ctx)
+		return uuid.Nil, "", ErrNoTwoFactorChallenge
+	default:
+		return uuid.Nil, "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return uuid.Nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	loginMethod := ts.sessionManager.GetString(ctx, twoFactorLoginMethodKey)
+	ts.clearChallenge(ctx)
+	return userID, loginMethod, nil
+}
+
+// clearChallenge removes the pending sign in from the request's session
+func (ts *TwoFactorService) clearChallenge(ctx context.Context) {
+	ts.sessionManager.Remove(ctx, twoFactorUserIDKey)
+	ts.sessionManager.Remove(ctx, twoFactorLoginMethodKey)
+	ts.sessionManager.Remove(ctx, twoFactorExpiresAtKey)
+}
+
+// verifyCode checks a code from the authenticator of userID, or else one of their unused
+// recovery codes, and uses it up. Invalid codes are counted in tx, which the caller
+// commits through commitFailedAttempt; too many in a row lock the user's codes.
+func (ts *TwoFactorService) verifyCode(ctx context.Context, tx pgx.Tx, userID uuid.UUID, code string) error {
+	// Lock the secret so the same code cannot be accepted twice concurrently
+	var secret string
+	var lastUsedStep int64
+	var failedAttempts int
+	var lockedUntil *time.Time
+	err := tx.QueryRow(ctx, `
+		SELECT secret, last_used_step, failed_attempts, locked_until FROM user_totp
+		WHERE user_id = $1 AND enabled_at IS NOT NULL
+		FOR UPDATE
+	`, userID).Scan(&secret, &lastUsedStep, &failedAttempts, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTwoFactorNotEnabled
+		}
+		return fmt.Errorf("failed to get totp secret: %w", err)
+	}
+	// Even a valid code is refused while locked, or guessing could go on
+	if lockedUntil != nil && ts.now().Before(*lockedUntil) {
+		return ErrTooManyTwoFactorAttempts
+	}
+
+	err = ts.useCode(ctx, tx, userID, secret, lastUsedStep, code)
+	switch err {
+	case nil:
+		if failedAttempts > 0 || lockedUntil != nil {
+			_, err = tx.Exec(ctx, `
+				UPDATE user_totp SET failed_attempts = 0, locked_until = NULL WHERE user_id = $1
+			`, userID)
+			if err != nil {
+				return fmt.Errorf("failed to reset failed attempts: %w", err)
+			}
+		}
+		return nil
+	case ErrInvalidTwoFactorCode:
+		failedAttempts++
+		var lockUntil *time.Time
+		if failedAttempts >= twoFactorMaxAttempts {
+			until := ts.now().Add(twoFactorLockout)
+			lockUntil = &until
+			failedAttempts = 0
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE user_totp SET failed_attempts = $1, locked_until = $2 WHERE user_id = $3
+		`, failedAttempts, lockUntil, userID)
+		if err != nil {
+			return fmt.Errorf("failed to count failed attempt: %w", err)
+		}
+		if lockUntil != nil {
+			return ErrTooManyTwoFactorAttempts
+		}
+		return ErrInvalidTwoFactorCode
+	default:
+		return err
+	}
+}
+
+// commitFailedAttempt commits the invalid code verifyCode counted, which returning err
+// would otherwise roll back, and returns err
+func commitFailedAttempt(ctx context.Context, tx pgx.Tx, err error) error {
+	if err != ErrInvalidTwoFactorCode && err != ErrTooManyTwoFactorAttempts {
+		return err
+	}
+	if commitErr := tx.Commit(ctx); commitErr != nil {
+		return fmt.Errorf("failed to commit transaction: %w", commitErr)
+	}
+	return err
+}
+
+// useCode accepts code if it is the current one of secret and newer than lastUsedStep,
+// or else one of the unused recovery codes of userID
+func (ts *TwoFactorService) useCode(ctx context.Context, tx pgx.Tx, userID uuid.UUID, secret string, lastUsedStep int64, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(secret, code, ts.now(), totpSkew); ok {
+		if step <= lastUsedStep {
+			return ErrInvalidTwoFactorCode
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2
+		`, step, userID)
+		if err != nil {
+			return fmt.Errorf("failed to update totp step: %w", err)
+		}
+		return nil
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`, ts.now(), userID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes gives userID a fresh set of recovery codes and returns them
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]string, error) {
+	_, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])
+	`, userID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a random code like "k3x7q-m2p9w"
+func newRecoveryCode() (string, error) {
+	codeBytes := make([]byte, 7)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(codeBytes))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode returns the form of a recovery code stored in the database. Case,
+// spaces and dashes do not matter.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/google/uuid"
+	"github.com/thediligencedev/betteridn/internal/testdb"
+	"github.com/thediligencedev/betteridn/pkg/totp"
+)
+
+// twoFactorFixture is a user with two-factor authentication enabled and a clock the
+// test moves by hand
+type twoFactorFixture struct {
+	ts            *TwoFactorService
+	ctx           context.Context
+	userID        uuid.UUID
+	secret        string
+	recoveryCodes []string
+	now           time.Time
+}
+
+func newTwoFactorFixture(t *testing.T) *twoFactorFixture {
+	t.Helper()
+	pool := testdb.New(t)
+	sm := scs.New()
+
+	f := &twoFactorFixture{
+		ts:     NewTwoFactorService(pool, sm),
+		ctx:    newSessionContext(t, sm),
+		userID: createUser(t, pool, "alice", "alice@example.com"),
+		now:    time.Unix(1_700_000_000, 0),
+	}
+	f.ts.now = func() time.Time { return f.now }
+
+	setup, err := f.ts.Setup(f.ctx, f.userID)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	f.secret = setup.Secret
+	f.recoveryCodes, err = f.ts.Enable(f.ctx, f.userID, f.code(t))
+	if err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	if len(f.recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(f.recoveryCodes), recoveryCodeCount)
+	}
+	return f
+}
+
+// code returns the authenticator's code at the current time
+func (f *twoFactorFixture) code(t *testing.T) string {
+	t.Helper()
+	code, err := totp.Code(f.secret, totp.Step(f.now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// verify starts a new sign in and completes it with code
+func (f *twoFactorFixture) verify(t *testing.T, code string) error {
+	t.Helper()
+	if err := f.ts.Challenge(f.ctx, f.userID, "password"); err != nil {
+		t.Fatalf("Challenge: %v", err)
+	}
+	userID, loginMethod, err := f.ts.Verify(f.ctx, code)
+	if err == nil && (userID != f.userID || loginMethod != "password") {
+		t.Fatalf("Verify signed in %s with %q, want %s with password", userID, loginMethod, f.userID)
+	}
+	return err
+}
+
+func TestTwoFactorRejectsReplayedCodes(t *testing.T) {
+	f := newTwoFactorFixture(t)
+
+	// The code that enabled two-factor authentication is used up
+	if err := f.verify(t, f.code(t)); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("code used by Enable: got %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	f.now = f.now.Add(totp.Period)
+	code := f.code(t)
+	if err := f.verify(t, code); err != nil {
+		t.Fatalf("fresh code: %v", err)
+	}
+	if err := f.verify(t, code); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("replayed code: got %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	// The code of the previous step is within the skew, but no newer than the last one used
+	f.now = f.now.Add(totp.Period)
+	earlier, err := totp.Code(f.secret, totp.Step(f.now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.verify(t, earlier); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("earlier code: got %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if err := f.verify(t, f.code(t)); err != nil {
+		t.Fatalf("next code: %v", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	f := newTwoFactorFixture(t)
+
+	if err := f.verify(t, f.recoveryCodes[0]); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if err := f.verify(t, f.recoveryCodes[0]); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("reused recovery code: got %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	// Case and dashes do not matter
+	loose := strings.ToUpper(strings.ReplaceAll(f.recoveryCodes[1], "-", ""))
+	if err := f.verify(t, loose); err != nil {
+		t.Fatalf("recovery code without dash: %v", err)
+	}
+
+	// Regenerating replaces every code, used or not
+	fresh, err := f.ts.RegenerateRecoveryCodes(f.ctx, f.userID, f.recoveryCodes[2])
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if err := f.verify(t, f.recoveryCodes[3]); err != ErrInvalidTwoFactorCode {
+		t.Fatalf("replaced recovery code: got %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if err := f.verify(t, fresh[0]); err != nil {
+		t.Fatalf("regenerated recovery code: %v", err)
+	}
+}
+
+func TestTwoFactorAttemptLimit(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	f.now = f.now.Add(totp.Period)
+
+	// Signing in again does not grant more guesses
+	for i := 1; i < twoFactorMaxAttempts; i++ {
+		if err := f.verify(t, "invalid"); err != ErrInvalidTwoFactorCode {
+			t.Fatalf("attempt %d: got %v, want ErrInvalidTwoFactorCode", i, err)
+		}
+	}
+	if err := f.verify(t, "invalid"); err != ErrTooManyTwoFactorAttempts {
+		t.Fatalf("last attempt: got %v, want ErrTooManyTwoFactorAttempts", err)
+	}
+
+	// The pending sign in is gone
+	if _, _, err := f.ts.Verify(f.ctx, f.code(t)); err != ErrNoTwoFactorChallenge {
+		t.Fatalf("after the limit: got %v, want ErrNoTwoFactorChallenge", err)
+	}
+
+	// A new sign in, or the other endpoints taking a code, are refused even a valid code
+	if err := f.verify(t, f.code(t)); err != ErrTooManyTwoFactorAttempts {
+		t.Fatalf("new sign in while locked: got %v, want ErrTooManyTwoFactorAttempts", err)
+	}
+	if err := f.ts.Disable(f.ctx, f.userID, f.recoveryCodes[0]); err != ErrTooManyTwoFactorAttempts {
+		t.Fatalf("Disable while locked: got %v, want ErrTooManyTwoFactorAttempts", err)
+	}
+
+	f.now = f.now.Add(twoFactorLockout)
+	if err := f.verify(t, f.code(t)); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+}
+
+func TestTwoFactorAttemptsResetOnSuccess(t *testing.T) {
+	f := newTwoFactorFixture(t)
+
+	for round := 0; round < 2; round++ {
+		for i := 1; i < twoFactorMaxAttempts; i++ {
+			if err := f.verify(t, "invalid"); err != ErrInvalidTwoFactorCode {
+				t.Fatalf("round %d attempt %d: got %v, want ErrInvalidTwoFactorCode", round, i, err)
+			}
+		}
+		f.now = f.now.Add(totp.Period)
+		if err := f.verify(t, f.code(t)); err != nil {
+			t.Fatalf("round %d valid code: %v", round, err)
+		}
+	}
+}
+
+func TestTwoFactorChallengeExpires(t *testing.T) {
+	f := newTwoFactorFixture(t)
+
+	if err := f.ts.Challenge(f.ctx, f.userID, "password"); err != nil {
+		t.Fatalf("Challenge: %v", err)
+	}
+	f.now = f.now.Add(twoFactorChallengeTTL)
+	if _, _, err := f.ts.Verify(f.ctx, f.code(t)); err != ErrNoTwoFactorChallenge {
+		t.Fatalf("expired challenge: got %v, want ErrNoTwoFactorChallenge", err)
+	}
+
+	// Just inside the window the same kind of code works
+	if err := f.ts.Challenge(f.ctx, f.userID, "password"); err != nil {
+		t.Fatalf("Challenge: %v", err)
+	}
+	f.now = f.now.Add(twoFactorChallengeTTL - time.Second)
+	if _, _, err := f.ts.Verify(f.ctx, f.code(t)); err != nil {
+		t.Fatalf("challenge within its TTL: %v", err)
+	}
+}
+
+func TestVerifyWithoutChallenge(t *testing.T) {
+	f := newTwoFactorFixture(t)
+	f.now = f.now.Add(totp.Period)
+
+	if _, _, err := f.ts.Verify(f.ctx, f.code(t)); err != ErrNoTwoFactorChallenge {
+		t.Fatalf("got %v, want ErrNoTwoFactorChallenge", err)
+	}
+}
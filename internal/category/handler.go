@@ -0,0 +1,190 @@
+package category
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/pkg/response"
+	"github.com/thediligencedev/betteridn/pkg/validator"
+)
+
+type Handler struct {
+	service *CategoryService
+}
+
+func NewHandler(pool *pgxpool.Pool) *Handler {
+	return &Handler{
+		service: NewCategoryService(pool),
+	}
+}
+
+type CategoryRequest struct {
+	Name        string `json:"name" validate:"required,max=50"`
+	Slug        string `json:"slug,omitempty" validate:"max=50"`
+	Description string `json:"description,omitempty" validate:"max=500"`
+}
+
+type MergeCategoryRequest struct {
+	Target string `json:"target" validate:"required"`
+}
+
+// GetCategories handles listing every category with its post count
+func (h *Handler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.service.GetCategories(r.Context())
+	if err != nil {
+		log.Printf("GetCategories error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "categories retrieved successfully",
+		"data":    categories,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetCategoryBySlug handles retrieving a single category
+func (h *Handler) GetCategoryBySlug(w http.ResponseWriter, r *http.Request) {
+	category, err := h.service.GetCategoryBySlug(r.Context(), r.PathValue("slug"))
+	if err != nil {
+		switch err {
+		case ErrCategoryNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "category not found")
+		default:
+			log.Printf("GetCategoryBySlug error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "category retrieved successfully",
+		"data":    category,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// CreateCategory handles creating a category (admin only)
+func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req CategoryRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	category, err := h.service.CreateCategory(r.Context(), req.Name, req.Slug, req.Description)
+	if err != nil {
+		respondWithServiceError(w, "CreateCategory", err)
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "category created successfully",
+		"data":    category,
+	}
+	response.RespondWithJSON(w, http.StatusCreated, responseJSON)
+}
+
+// UpdateCategory handles renaming a category and updating its slug and description (admin only)
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	var req CategoryRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	category, err := h.service.UpdateCategory(r.Context(), slug, req.Name, req.Slug, req.Description)
+	if err != nil {
+		respondWithServiceError(w, "UpdateCategory", err)
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "category updated successfully",
+		"data":    category,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// MergeCategory handles merging the category in the path into the target category (admin only)
+func (h *Handler) MergeCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	var req MergeCategoryRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	category, err := h.service.MergeCategory(r.Context(), slug, req.Target)
+	if err != nil {
+		respondWithServiceError(w, "MergeCategory", err)
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "categories merged successfully",
+		"data":    category,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// DeleteCategory handles deleting a category without posts (admin only)
+func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	if err := h.service.DeleteCategory(r.Context(), slug); err != nil {
+		respondWithServiceError(w, "DeleteCategory", err)
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "category deleted successfully",
+		"data": map[string]string{
+			"slug": slug,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// decodeRequest parses and validates a JSON request body into req,
+// writing an error response and returning false if it is invalid
+func decodeRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// respondWithServiceError maps a CategoryService error to a response
+func respondWithServiceError(w http.ResponseWriter, op string, err error) {
+	switch err {
+	case ErrCategoryNotFound:
+		response.RespondWithError(w, http.StatusNotFound, "category not found")
+	case ErrCategoryExists:
+		response.RespondWithError(w, http.StatusConflict, "category with this name or slug already exists")
+	case ErrCategoryInUse:
+		response.RespondWithError(w, http.StatusConflict, "category still has posts, merge it into another category instead")
+	case ErrInvalidSlug:
+		response.RespondWithError(w, http.StatusBadRequest, "slug must contain only lowercase letters, digits and single hyphens")
+	case ErrMergeIntoSelf:
+		response.RespondWithError(w, http.StatusBadRequest, "cannot merge a category into itself")
+	default:
+		log.Printf("%s error: %v", op, err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,321 @@
+package category
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/db"
+	"github.com/thediligencedev/betteridn/internal/models"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("category with this name or slug already exists")
+	ErrCategoryInUse    = errors.New("category still has posts")
+	ErrInvalidSlug      = errors.New("invalid slug")
+	ErrMergeIntoSelf    = errors.New("cannot merge a category into itself")
+)
+
+var (
+	// slugPattern is what Slugify produces: lowercase words joined by single hyphens
+	slugPattern  = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	nonSlugRunes = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// categoryColumns is the select list shared by category queries; scan it with scanCategory
+const categoryColumns = `
+	c.id, c.name, c.slug, COALESCE(c.description, ''), c.created_at, COALESCE(c.updated_at, c.created_at),
+	(SELECT COUNT(*) FROM post_categories pc JOIN posts p ON pc.post_id = p.id
+		WHERE pc.category_id = c.id AND p.status = 'published' AND p.deleted_at IS NULL)
+`
+
+type CategoryService struct {
+	pool *pgxpool.Pool
+}
+
+func NewCategoryService(pool *pgxpool.Pool) *CategoryService {
+	return &CategoryService{pool: pool}
+}
+
+// GetCategories retrieves every category with its post count, ordered by name
+func (s *CategoryService) GetCategories(ctx context.Context) ([]models.Category, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories c
+		ORDER BY c.name ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan category row: %w", err)
+		}
+		categories = append(categories, *category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating category rows: %w", err)
+	}
+
+	return categories, nil
+}
+
+// GetCategoryBySlug retrieves a single category with its post count
+func (s *CategoryService) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories c
+		WHERE c.slug = $1
+	`, slug)
+
+	category, err := scanCategory(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+	return category, nil
+}
+
+// CreateCategory creates a category. When slug is empty it is derived from name.
+func (s *CategoryService) CreateCategory(ctx context.Context, name, slug, description string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	slug, err := normalizeSlug(name, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	var categoryID uuid.UUID
+	err = s.pool.QueryRow(ctx, `
+		INSERT INTO categories (name, slug, description)
+		VALUES ($1, $2, NULLIF($3, ''))
+		RETURNING id
+	`, name, slug, description).Scan(&categoryID)
+	if err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, ErrCategoryExists
+		}
+		return nil, fmt.Errorf("failed to create category: %w", err)
+	}
+
+	return s.getCategoryByID(ctx, categoryID)
+}
+
+// UpdateCategory renames the category identified by slug and replaces its slug and
+// description. When newSlug is empty it is derived from name.
+func (s *CategoryService) UpdateCategory(ctx context.Context, slug, name, newSlug, description string) (*models.Category, error) {
+	name = strings.TrimSpace(name)
+	newSlug, err := normalizeSlug(name, newSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	var categoryID uuid.UUID
+	err = s.pool.QueryRow(ctx, `
+		UPDATE categories
+		SET name = $1, slug = $2, description = NULLIF($3, ''), updated_at = NOW()
+		WHERE slug = $4
+		RETURNING id
+	`, name, newSlug, description, slug).Scan(&categoryID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCategoryNotFound
+		}
+		if db.IsUniqueViolation(err) {
+			return nil, ErrCategoryExists
+		}
+		return nil, fmt.Errorf("failed to update category: %w", err)
+	}
+
+	return s.getCategoryByID(ctx, categoryID)
+}
+
+// MergeCategory moves every post of the source category into the target category and
+// deletes the source. Posts already in both categories keep a single association.
+func (s *CategoryService) MergeCategory(ctx context.Context, sourceSlug, targetSlug string) (*models.Category, error) {
+	if sourceSlug == targetSlug {
+		return nil, ErrMergeIntoSelf
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock both rows so a concurrent merge or delete cannot interleave
+	ids, err := lockCategories(ctx, tx, sourceSlug, targetSlug)
+	if err != nil {
+		return nil, err
+	}
+	sourceID, targetID := ids[sourceSlug], ids[targetSlug]
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO post_categories (post_id, category_id)
+		SELECT post_id, $2 FROM post_categories WHERE category_id = $1
+		ON CONFLICT (post_id, category_id) DO NOTHING
+	`, sourceID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move post categories: %w", err)
+	}
+
+	// Cascades to the remaining post_categories rows of the source
+	_, err = tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete merged category: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getCategoryByID(ctx, targetID)
+}
+
+// DeleteCategory deletes a category that no post uses. Categories with posts
+// have to be merged into another one instead so no post loses its category.
+func (s *CategoryService) DeleteCategory(ctx context.Context, slug string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	categoryID, err := lockCategory(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM post_categories WHERE category_id = $1)
+	`, categoryID).Scan(&inUse)
+	if err != nil {
+		return fmt.Errorf("failed to check category posts: %w", err)
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM categories WHERE id = $1`, categoryID)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// getCategoryByID retrieves a single category with its post count
+func (s *CategoryService) getCategoryByID(ctx context.Context, categoryID uuid.UUID) (*models.Category, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories c
+		WHERE c.id = $1
+	`, categoryID)
+
+	category, err := scanCategory(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+	return category, nil
+}
+
+// lockCategory locks the category identified by slug for the rest of tx and returns its ID
+func lockCategory(ctx context.Context, tx pgx.Tx, slug string) (uuid.UUID, error) {
+	var categoryID uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM categories WHERE slug = $1 FOR UPDATE
+	`, slug).Scan(&categoryID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrCategoryNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to lock category: %w", err)
+	}
+	return categoryID, nil
+}
+
+// lockCategories locks the categories with the given distinct slugs in id order, so
+// transactions locking the same categories in any order cannot deadlock, and returns
+// their IDs by slug
+func lockCategories(ctx context.Context, tx pgx.Tx, slugs ...string) (map[string]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT slug, id FROM categories WHERE slug = ANY($1) ORDER BY id FOR UPDATE
+	`, slugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock categories: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]uuid.UUID, len(slugs))
+	for rows.Next() {
+		var slug string
+		var id uuid.UUID
+		if err := rows.Scan(&slug, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		ids[slug] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock categories: %w", err)
+	}
+
+	if len(ids) != len(slugs) {
+		return nil, ErrCategoryNotFound
+	}
+	return ids, nil
+}
+
+// scanCategory scans a row selected with categoryColumns
+func scanCategory(row pgx.Row) (*models.Category, error) {
+	var c models.Category
+	err := row.Scan(
+		&c.ID,
+		&c.Name,
+		&c.Slug,
+		&c.Description,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.PostCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// normalizeSlug validates slug, or derives one from name when slug is empty
+func normalizeSlug(name, slug string) (string, error) {
+	if slug == "" {
+		slug = Slugify(name)
+	}
+	if !slugPattern.MatchString(slug) {
+		return "", ErrInvalidSlug
+	}
+	return slug, nil
+}
+
+// Slugify turns a category name into a URL-friendly slug, e.g. "Tech & Science" -> "tech-science".
+// It matches the backfill in the categories migration.
+func Slugify(name string) string {
+	return strings.Trim(nonSlugRunes.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,394 @@
+package comment
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/pkg/response"
+	"github.com/thediligencedev/betteridn/pkg/validator"
+)
+
+type Handler struct {
+	service *CommentService
+}
+
+func NewHandler(pool *pgxpool.Pool, maxDepth int, notifier *notification.NotificationService) *Handler {
+	return &Handler{
+		service: NewCommentService(pool, maxDepth, notifier),
+	}
+}
+
+type CreateCommentRequest struct {
+	Content  string     `json:"content" validate:"required"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+}
+
+type UpdateCommentRequest struct {
+	Content string `json:"content" validate:"required"`
+}
+
+type VoteCommentRequest struct {
+	VoteType int `json:"vote_type" validate:"required,oneof=1 -1"`
+}
+
+// CreateComment handles adding a comment to a post
+func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	// Parse request body
+	var req CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Validate request
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error: "+err.Error())
+		return
+	}
+
+	commentID, err := h.service.CreateComment(r.Context(), postID, userUUID, req.ParentID, req.Content)
+	if err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrParentNotFound:
+			response.RespondWithError(w, http.StatusBadRequest, "parent comment not found")
+		case ErrMaxDepthExceeded:
+			response.RespondWithError(w, http.StatusBadRequest, "maximum reply depth exceeded")
+		case ErrValidationFailed:
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed")
+		default:
+			log.Printf("CreateComment error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "comment created successfully",
+		"data": map[string]string{
+			"id": commentID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusCreated, responseJSON)
+}
+
+// GetComments handles retrieving a paginated list of top-level comments for a post,
+// each with a preview of its reply tree
+func (h *Handler) GetComments(w http.ResponseWriter, r *http.Request) {
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	// Parse pagination parameters
+	page := 1
+	limit := 20
+	replies := defaultRepliesLimit
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
+			page = pageNum
+		}
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 && limitNum <= 100 {
+			limit = limitNum
+		}
+	}
+
+	if repliesStr := r.URL.Query().Get("replies"); repliesStr != "" {
+		if repliesNum, err := strconv.Atoi(repliesStr); err == nil && repliesNum >= 0 && repliesNum <= maxRepliesPerRequest {
+			replies = repliesNum
+		}
+	}
+
+	sort := r.URL.Query().Get("sort")
+
+	comments, err := h.service.GetComments(r.Context(), postID, sort, page, limit, replies)
+	if err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrInvalidSort:
+			response.RespondWithError(w, http.StatusBadRequest, "invalid sort, must be one of old, new, top")
+		default:
+			log.Printf("GetComments error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "comments retrieved successfully",
+		"data":    comments,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetReplies handles loading more replies under a comment, following a replies cursor
+func (h *Handler) GetReplies(w http.ResponseWriter, r *http.Request) {
+	postID, commentID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	replies := defaultRepliesLimit
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 && limitNum <= maxRepliesPerRequest {
+			limit = limitNum
+		}
+	}
+
+	if repliesStr := r.URL.Query().Get("replies"); repliesStr != "" {
+		if repliesNum, err := strconv.Atoi(repliesStr); err == nil && repliesNum >= 0 && repliesNum <= maxRepliesPerRequest {
+			replies = repliesNum
+		}
+	}
+
+	comments, nextCursor, err := h.service.GetReplies(r.Context(), postID, commentID, r.URL.Query().Get("cursor"), limit, replies)
+	if err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrCommentNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "comment not found")
+		case ErrInvalidCursor:
+			response.RespondWithError(w, http.StatusBadRequest, "invalid cursor")
+		default:
+			log.Printf("GetReplies error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message":     "replies retrieved successfully",
+		"data":        comments,
+		"next_cursor": nextCursor,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetCommentByID handles retrieving a single comment
+func (h *Handler) GetCommentByID(w http.ResponseWriter, r *http.Request) {
+	postID, commentID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	comment, err := h.service.GetCommentByID(r.Context(), postID, commentID)
+	if err != nil {
+		switch err {
+		case ErrCommentNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "comment not found")
+		default:
+			log.Printf("GetCommentByID error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "comment retrieved successfully",
+		"data":    comment,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// UpdateComment handles editing an existing comment
+func (h *Handler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, commentID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse request body
+	var req UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Validate request
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error: "+err.Error())
+		return
+	}
+
+	err := h.service.UpdateComment(r.Context(), postID, commentID, userUUID, req.Content)
+	if err != nil {
+		switch err {
+		case ErrCommentNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "comment not found")
+		case ErrUnauthorized:
+			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to update this comment")
+		case ErrValidationFailed:
+			response.RespondWithError(w, http.StatusBadRequest, "validation failed")
+		default:
+			log.Printf("UpdateComment error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "comment updated successfully",
+		"data": map[string]string{
+			"id": commentID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// DeleteComment handles removing a comment
+func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, commentID, ok := pathIDs(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.DeleteComment(r.Context(), postID, commentID, userUUID)
+	if err != nil {
+		switch err {
+		case ErrCommentNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "comment not found")
+		case ErrUnauthorized:
+			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to delete this comment")
+		default:
+			log.Printf("DeleteComment error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "comment deleted successfully",
+		"data": map[string]string{
+			"id": commentID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// VoteComment handles voting on a comment
+func (h *Handler) VoteComment(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	commentID, err := uuid.Parse(r.PathValue("commentId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid comment ID format")
+		return
+	}
+
+	// Parse request body
+	var req VoteCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Validate request
+	if err := validator.ValidateStruct(&req); err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "validation error: "+err.Error())
+		return
+	}
+
+	result, err := h.service.VoteComment(r.Context(), commentID, userUUID, req.VoteType)
+	if err != nil {
+		switch err {
+		case ErrCommentNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "comment not found")
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrInvalidVoteType:
+			response.RespondWithError(w, http.StatusBadRequest, "invalid vote type, must be 1 (upvote) or -1 (downvote)")
+		default:
+			log.Printf("VoteComment error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Determine the appropriate message based on whether the vote was removed
+	message := "vote recorded successfully"
+	if result.VoteRemoved {
+		message = "successfully removed vote"
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": message,
+		"data": map[string]interface{}{
+			"id":         commentID.String(),
+			"vote_count": result.VoteCount,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// Helper functions
+
+// pathIDs parses the {postId} and {commentId} path values
+func pathIDs(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	commentID, err := uuid.Parse(r.PathValue("commentId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid comment ID format")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return postID, commentID, true
+}
@@ -0,0 +1,805 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/counter"
+	"github.com/thediligencedev/betteridn/internal/mention"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+	"github.com/thediligencedev/betteridn/pkg/markdown"
+)
+
+var (
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrPostNotFound     = errors.New("post not found")
+	ErrPostDeleted      = errors.New("post has been deleted")
+	ErrParentNotFound   = errors.New("parent comment not found")
+	ErrMaxDepthExceeded = errors.New("maximum reply depth exceeded")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrInvalidSort      = errors.New("invalid sort, must be one of old, new, top")
+	ErrInvalidVoteType  = errors.New("invalid vote type, must be 1 (upvote) or -1 (downvote)")
+	ErrUnauthorized     = errors.New("unauthorized to modify this comment")
+	ErrValidationFailed = errors.New("validation failed")
+	ErrInternalServer   = errors.New("internal server error")
+)
+
+const (
+	defaultRepliesLimit  = 3
+	maxRepliesPerRequest = 100
+)
+
+// commentColumns is the select list shared by every comment query; scan it with scanComment.
+// It expects the comments table aliased as c and joined with commentJoins.
+const commentColumns = `
+	c.id, c.post_id, c.parent_id, c.depth, COALESCE(c.content, ''), c.deleted_at IS NOT NULL,
+	c.created_at, COALESCE(c.updated_at, c.created_at), u.username,
+	c.reply_count, c.upvotes, c.downvotes
+`
+
+// commentJoins adds the author needed by commentColumns
+const commentJoins = `
+	JOIN users u ON c.user_id = u.id
+`
+
+// Sort modes for top-level comments
+const (
+	SortOld = "old"
+	SortNew = "new"
+	SortTop = "top"
+)
+
+// commentOrderBy maps a sort mode to its ORDER BY clause; ids break ties for a stable order
+var commentOrderBy = map[string]string{
+	SortOld: "c.created_at ASC, c.id ASC",
+	SortNew: "c.created_at DESC, c.id DESC",
+	SortTop: "c.score DESC, c.created_at ASC, c.id ASC",
+}
+
+type CommentService struct {
+	pool     *pgxpool.Pool
+	maxDepth int
+	notifier *notification.NotificationService
+	mentions *mention.MentionService
+}
+
+func NewCommentService(pool *pgxpool.Pool, maxDepth int, notifier *notification.NotificationService) *CommentService {
+	return &CommentService{
+		pool:     pool,
+		maxDepth: maxDepth,
+		notifier: notifier,
+		mentions: mention.NewMentionService(pool, notifier),
+	}
+}
+
+// CreateComment adds a comment to a post, optionally as a reply to parentID,
+// and updates the post's comment metadata
+func (s *CommentService) CreateComment(ctx context.Context, postID, userID uuid.UUID, parentID *uuid.UUID, content string) (uuid.UUID, error) {
+	if content == "" {
+		return uuid.Nil, ErrValidationFailed
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the post row so concurrent comments update the metadata in order
+	postOwnerID, deleted, err := lockPost(ctx, tx, postID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if deleted {
+		return uuid.Nil, ErrPostDeleted
+	}
+
+	// Replies notify the parent's author, top-level comments the post's author
+	recipientID := postOwnerID
+	depth := 0
+	if parentID != nil {
+		var parentDepth int
+		err = tx.QueryRow(ctx, `
+			SELECT depth, user_id FROM comments
+			WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL
+		`, *parentID, postID).Scan(&parentDepth, &recipientID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return uuid.Nil, ErrParentNotFound
+			}
+			return uuid.Nil, fmt.Errorf("failed to get parent comment: %w", err)
+		}
+
+		depth = parentDepth + 1
+		if depth > s.maxDepth {
+			return uuid.Nil, ErrMaxDepthExceeded
+		}
+	}
+
+	var commentID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		INSERT INTO comments (post_id, user_id, parent_id, depth, content, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id
+	`, postID, userID, parentID, depth, content).Scan(&commentID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	if err = syncCommentsMetadata(ctx, tx, postID, uuid.Nil); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = updateCommentCounters(ctx, tx, postID, parentID, 1); err != nil {
+		return uuid.Nil, err
+	}
+
+	data := map[string]any{"post_id": postID}
+	if parentID != nil {
+		data["parent_id"] = *parentID
+	}
+	err = s.notifier.Notify(ctx, tx, notification.NewNotification{
+		UserID:      recipientID,
+		FromUserID:  userID,
+		Type:        notification.TypeNewComment,
+		SubjectType: notification.SubjectComment,
+		SubjectID:   commentID,
+		Data:        data,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = s.mentions.Sync(ctx, tx, mention.SubjectComment, commentID, postID, userID, content); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return commentID, nil
+}
+
+// GetComments retrieves a paginated list of top-level comments for a post in the given sort order.
+// Each comment carries up to repliesLimit replies per level, oldest first, down to the maximum
+// depth; subtrees with more replies expose a RepliesCursor for GetReplies.
+func (s *CommentService) GetComments(ctx context.Context, postID uuid.UUID, sort string, page, limit, repliesLimit int) ([]*models.Comment, error) {
+	if sort == "" {
+		sort = SortOld
+	}
+	orderBy, ok := commentOrderBy[sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	if repliesLimit < 0 || repliesLimit > maxRepliesPerRequest {
+		repliesLimit = defaultRepliesLimit
+	}
+
+	offset := (page - 1) * limit
+
+	if err := checkPostExists(ctx, s.pool, postID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments c
+		`+commentJoins+`
+		WHERE c.post_id = $1 AND c.parent_id IS NULL
+		ORDER BY `+orderBy+`
+		LIMIT $2 OFFSET $3
+	`, postID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query comments: %w", err)
+	}
+
+	comments, err := collectComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadReplies(ctx, comments, repliesLimit); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachMentions(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// GetReplies retrieves the next page of direct replies to a comment after the given cursor,
+// each with its own nested replies loaded like GetComments. It returns the cursor for the
+// following page, or an empty string when there are no more replies.
+func (s *CommentService) GetReplies(ctx context.Context, postID, commentID uuid.UUID, after string, limit, repliesLimit int) ([]*models.Comment, string, error) {
+	if limit < 1 || limit > maxRepliesPerRequest {
+		limit = 20
+	}
+	if repliesLimit < 0 || repliesLimit > maxRepliesPerRequest {
+		repliesLimit = defaultRepliesLimit
+	}
+
+	afterTime := time.Time{}
+	afterID := uuid.Nil
+	if after != "" {
+		c, err := cursor.Parse(after)
+		if err != nil || c.Backward {
+			return nil, "", ErrInvalidCursor
+		}
+		afterTime, afterID = c.Time, c.ID
+	}
+
+	if err := checkPostExists(ctx, s.pool, postID); err != nil {
+		return nil, "", err
+	}
+
+	var exists bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND post_id = $2)
+	`, commentID, postID).Scan(&exists)
+	if err != nil {
+		return nil, "", ErrInternalServer
+	}
+	if !exists {
+		return nil, "", ErrCommentNotFound
+	}
+
+	// Fetch one extra row to know whether another page follows
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments c
+		`+commentJoins+`
+		WHERE c.parent_id = $1 AND (c.created_at, c.id) > ($2, $3)
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT $4
+	`, commentID, afterTime, afterID, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query replies: %w", err)
+	}
+
+	replies, err := collectComments(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(replies) > limit {
+		replies = replies[:limit]
+		last := replies[len(replies)-1]
+		nextCursor = cursor.After(last.CreatedAt, 0, last.ID).String()
+	}
+
+	if err := s.loadReplies(ctx, replies, repliesLimit); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.attachMentions(ctx, replies); err != nil {
+		return nil, "", err
+	}
+
+	return replies, nextCursor, nil
+}
+
+// GetCommentByID retrieves a single comment belonging to the given post
+func (s *CommentService) GetCommentByID(ctx context.Context, postID, commentID uuid.UUID) (*models.Comment, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments c
+		`+commentJoins+`
+		WHERE c.id = $1 AND c.post_id = $2
+	`, commentID, postID)
+
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	if err := s.attachMentions(ctx, []*models.Comment{comment}); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// UpdateComment replaces the content of a comment owned by the user
+func (s *CommentService) UpdateComment(ctx context.Context, postID, commentID, userID uuid.UUID, content string) error {
+	if content == "" {
+		return ErrValidationFailed
+	}
+
+	if err := s.checkOwnership(ctx, postID, commentID, userID); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE comments
+		SET content = $1, updated_at = $2
+		WHERE id = $3
+	`, content, time.Now(), commentID)
+	if err != nil {
+		return fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	// Only users newly mentioned by this edit are notified
+	if err = s.mentions.Sync(ctx, tx, mention.SubjectComment, commentID, postID, userID, content); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteComment removes a comment owned by the user. A comment that still has replies is
+// replaced by a placeholder so the thread below it stays intact; otherwise the row is
+// removed and the post's comment metadata is updated.
+func (s *CommentService) DeleteComment(ctx context.Context, postID, commentID, userID uuid.UUID) error {
+	if err := s.checkOwnership(ctx, postID, commentID, userID); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	if _, _, err = lockPost(ctx, tx, postID); err != nil {
+		return err
+	}
+
+	// Re-read under the post lock so a concurrent delete cannot adjust the counters twice
+	var parentID *uuid.UUID
+	var hasReplies bool
+	err = tx.QueryRow(ctx, `
+		SELECT c.parent_id, EXISTS(SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		FROM comments c
+		WHERE c.id = $1 AND c.deleted_at IS NULL
+	`, commentID).Scan(&parentID, &hasReplies)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrCommentNotFound
+		}
+		return fmt.Errorf("failed to check comment replies: %w", err)
+	}
+
+	if err = s.mentions.Clear(ctx, tx, mention.SubjectComment, commentID); err != nil {
+		return err
+	}
+
+	if hasReplies {
+		_, err = tx.Exec(ctx, `
+			UPDATE comments
+			SET content = NULL, deleted_at = NOW()
+			WHERE id = $1
+		`, commentID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		// The placeholder still counts as a reply of its parent
+		if err = updateCommentCounters(ctx, tx, postID, nil, -1); err != nil {
+			return err
+		}
+	} else {
+		// The metadata references the comment, so it has to move off it before the delete
+		if err = syncCommentsMetadata(ctx, tx, postID, commentID); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM comments
+			WHERE id = $1
+		`, commentID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		if err = updateCommentCounters(ctx, tx, postID, parentID, -1); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// VoteComment records a vote on a comment with the same toggle semantics as post votes:
+// repeating a vote removes it and the opposite vote replaces it
+func (s *CommentService) VoteComment(ctx context.Context, commentID, userID uuid.UUID, voteType int) (*models.VoteResult, error) {
+	// Validate vote type
+	if voteType != 1 && voteType != -1 {
+		return nil, ErrInvalidVoteType
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	// Check if comment exists, locking it so concurrent votes update the counters in order
+	var commentOwnerID, postID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, post_id FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, commentID).Scan(&commentOwnerID, &postID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, ErrInternalServer
+	}
+
+	// Comments of deleted and unpublished posts cannot be voted on. The post is not locked,
+	// since other writers lock it before its comments.
+	if err = checkPostExists(ctx, tx, postID); err != nil {
+		return nil, err
+	}
+
+	// Track if the vote was removed
+	voteRemoved := false
+
+	// Check if user has already voted on this comment
+	var existingVoteID uuid.UUID
+	var existingVoteType int
+	err = tx.QueryRow(ctx, `
+		SELECT id, vote_type FROM comment_votes
+		WHERE comment_id = $1 AND user_id = $2
+	`, commentID, userID).Scan(&existingVoteID, &existingVoteType)
+
+	if err == nil {
+		if existingVoteType == voteType {
+			// Same vote type, remove the vote
+			_, err = tx.Exec(ctx, `
+				DELETE FROM comment_votes
+				WHERE id = $1
+			`, existingVoteID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to remove vote: %w", err)
+			}
+			voteRemoved = true
+		} else {
+			// Different vote type, update the vote
+			_, err = tx.Exec(ctx, `
+				UPDATE comment_votes
+				SET vote_type = $1
+				WHERE id = $2
+			`, voteType, existingVoteID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update vote: %w", err)
+			}
+		}
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		// User has not voted yet, insert new vote
+		_, err = tx.Exec(ctx, `
+			INSERT INTO comment_votes (comment_id, user_id, vote_type)
+			VALUES ($1, $2, $3)
+		`, commentID, userID, voteType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert vote: %w", err)
+		}
+	} else {
+		return nil, fmt.Errorf("failed to check existing vote: %w", err)
+	}
+
+	newVoteType := voteType
+	if voteRemoved {
+		newVoteType = 0
+	}
+	upDelta, downDelta := counter.VoteDelta(existingVoteType, newVoteType)
+
+	var voteCount models.VoteCount
+	err = tx.QueryRow(ctx, `
+		UPDATE comments
+		SET upvotes = upvotes + $1, downvotes = downvotes + $2, score = score + $1 - $2
+		WHERE id = $3
+		RETURNING upvotes, downvotes
+	`, upDelta, downDelta, commentID).Scan(&voteCount.Upvotes, &voteCount.Downvotes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update vote counters: %w", err)
+	}
+
+	// Let the author know about new upvotes
+	if voteType == 1 && !voteRemoved {
+		err = s.notifier.Notify(ctx, tx, notification.NewNotification{
+			UserID:      commentOwnerID,
+			FromUserID:  userID,
+			Type:        notification.TypeCommentLike,
+			SubjectType: notification.SubjectComment,
+			SubjectID:   commentID,
+			Data:        map[string]any{"post_id": postID},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &models.VoteResult{
+		VoteCount:   voteCount,
+		VoteRemoved: voteRemoved,
+	}, nil
+}
+
+// Helper functions
+
+// updateCommentCounters adds delta to the post's comment count and, when parentID is set,
+// to the parent comment's reply count
+func updateCommentCounters(ctx context.Context, tx pgx.Tx, postID uuid.UUID, parentID *uuid.UUID, delta int) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE posts SET comment_count = comment_count + $1 WHERE id = $2
+	`, delta, postID)
+	if err != nil {
+		return fmt.Errorf("failed to update comment count: %w", err)
+	}
+
+	if parentID != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE comments SET reply_count = reply_count + $1 WHERE id = $2
+		`, delta, *parentID)
+		if err != nil {
+			return fmt.Errorf("failed to update reply count: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadReplies attaches up to perParent replies to each parent, one query per tree level
+func (s *CommentService) loadReplies(ctx context.Context, parents []*models.Comment, perParent int) error {
+	for level := 0; len(parents) > 0 && perParent > 0 && level < s.maxDepth; level++ {
+		byID := make(map[uuid.UUID]*models.Comment, len(parents))
+		parentIDs := make([]uuid.UUID, 0, len(parents))
+		for _, p := range parents {
+			if p.ReplyCount == 0 {
+				continue
+			}
+			byID[p.ID] = p
+			parentIDs = append(parentIDs, p.ID)
+		}
+		if len(parentIDs) == 0 {
+			return nil
+		}
+
+		rows, err := s.pool.Query(ctx, `
+			SELECT `+commentColumns+`
+			FROM (
+				SELECT *, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY created_at ASC, id ASC) AS rn
+				FROM comments
+				WHERE parent_id = ANY($1)
+			) c
+			`+commentJoins+`
+			WHERE c.rn <= $2
+			ORDER BY c.parent_id, c.created_at ASC, c.id ASC
+		`, parentIDs, perParent)
+		if err != nil {
+			return fmt.Errorf("failed to query replies: %w", err)
+		}
+
+		children, err := collectComments(rows)
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			parent := byID[*child.ParentID]
+			parent.Replies = append(parent.Replies, child)
+		}
+		for _, p := range byID {
+			if len(p.Replies) > 0 && p.ReplyCount > len(p.Replies) {
+				last := p.Replies[len(p.Replies)-1]
+				p.RepliesCursor = cursor.After(last.CreatedAt, 0, last.ID).String()
+			}
+		}
+
+		parents = children
+	}
+	return nil
+}
+
+// attachMentions fills in the mention spans of every comment in the given trees
+func (s *CommentService) attachMentions(ctx context.Context, roots []*models.Comment) error {
+	all := []*models.Comment{}
+	var walk func([]*models.Comment)
+	walk = func(comments []*models.Comment) {
+		for _, c := range comments {
+			all = append(all, c)
+			walk(c.Replies)
+		}
+	}
+	walk(roots)
+
+	contents := make(map[uuid.UUID]string, len(all))
+	for _, c := range all {
+		if !c.IsDeleted {
+			contents[c.ID] = c.Content
+		}
+	}
+
+	spans, err := s.mentions.Spans(ctx, mention.SubjectComment, contents)
+	if err != nil {
+		return err
+	}
+	for _, c := range all {
+		c.Mentions = spans[c.ID]
+	}
+	return nil
+}
+
+// checkPostExists applies the conditions of lockPost without the lock: it returns
+// ErrPostNotFound unless the post is published and ErrPostDeleted if it was deleted
+func checkPostExists(ctx context.Context, q interface {
+	QueryRow(context.Context, string, ...any) pgx.Row
+}, postID uuid.UUID) error {
+	var deleted bool
+	err := q.QueryRow(ctx, `
+		SELECT deleted_at IS NOT NULL FROM posts WHERE id = $1 AND status = 'published'
+	`, postID).Scan(&deleted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPostNotFound
+		}
+		return ErrInternalServer
+	}
+	if deleted {
+		return ErrPostDeleted
+	}
+	return nil
+}
+
+// checkOwnership verifies the comment exists on the post, is not deleted and belongs to the user
+func (s *CommentService) checkOwnership(ctx context.Context, postID, commentID, userID uuid.UUID) error {
+	var ownerID uuid.UUID
+	err := s.pool.QueryRow(ctx, `
+		SELECT user_id FROM comments
+		WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL
+	`, commentID, postID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrCommentNotFound
+		}
+		return ErrInternalServer
+	}
+
+	if ownerID != userID {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// scanComment scans a row selected with commentColumns, masking deleted comments
+func scanComment(row pgx.Row) (*models.Comment, error) {
+	var comment models.Comment
+	var username string
+	var voteCount models.VoteCount
+
+	err := row.Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.ParentID,
+		&comment.Depth,
+		&comment.Content,
+		&comment.IsDeleted,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&username,
+		&comment.ReplyCount,
+		&voteCount.Upvotes,
+		&voteCount.Downvotes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	comment.VoteCount = &voteCount
+
+	if comment.IsDeleted {
+		comment.Content = models.DeletedCommentPlaceholder
+		comment.ContentHTML = markdown.Render(comment.Content)
+		return &comment, nil
+	}
+	comment.ContentHTML = markdown.Render(comment.Content)
+
+	comment.User = &models.UserBasic{
+		Username: username,
+	}
+	return &comment, nil
+}
+
+// collectComments scans and closes rows selected with commentColumns
+func collectComments(rows pgx.Rows) ([]*models.Comment, error) {
+	defer rows.Close()
+
+	comments := []*models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment row: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating comment rows: %w", err)
+	}
+
+	return comments, nil
+}
+
+// lockPost takes a row lock on the post for the rest of the transaction and returns its author
+// and whether the post is soft-deleted. Unpublished posts are not found.
+func lockPost(ctx context.Context, tx pgx.Tx, postID uuid.UUID) (uuid.UUID, bool, error) {
+	var ownerID uuid.UUID
+	var deleted bool
+	err := tx.QueryRow(ctx, `
+		SELECT user_id, deleted_at IS NOT NULL FROM posts WHERE id = $1 AND status = 'published' FOR UPDATE
+	`, postID).Scan(&ownerID, &deleted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, false, ErrPostNotFound
+		}
+		return uuid.Nil, false, fmt.Errorf("failed to lock post: %w", err)
+	}
+	return ownerID, deleted, nil
+}
+
+// syncCommentsMetadata recomputes the first/last comment of a post from the comments table,
+// ignoring excludeID (pass uuid.Nil to consider every comment)
+func syncCommentsMetadata(ctx context.Context, tx pgx.Tx, postID, excludeID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO post_comments_metadata (post_id, first_comment_id, first_comment_at, last_comment_id, last_comment_at)
+		SELECT $1, f.id, f.created_at, l.id, l.created_at
+		FROM (SELECT 1) AS base
+		LEFT JOIN LATERAL (
+			SELECT id, created_at FROM comments
+			WHERE post_id = $1 AND id <> $2
+			ORDER BY created_at ASC, id ASC
+			LIMIT 1
+		) f ON true
+		LEFT JOIN LATERAL (
+			SELECT id, created_at FROM comments
+			WHERE post_id = $1 AND id <> $2
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) l ON true
+		ON CONFLICT (post_id) DO UPDATE
+		SET first_comment_id = EXCLUDED.first_comment_id,
+		    first_comment_at = EXCLUDED.first_comment_at,
+		    last_comment_id = EXCLUDED.last_comment_id,
+		    last_comment_at = EXCLUDED.last_comment_at
+	`, postID, excludeID)
+	if err != nil {
+		return fmt.Errorf("failed to update comments metadata: %w", err)
+	}
+	return nil
+}
@@ -2,32 +2,39 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DBHost                 string
-	DBPort                 string
-	DBUser                 string
-	DBPassword             string
-	DBName                 string
-	DBSSLMode              string
-	ServerPort             string
-	ServerEnv              string
-	SessionSecret          string
-	SessionExpiry          time.Duration
-	GoogleClientID         string
-	GoogleClientSecret     string
-	GoogleOAuthRedirectURL string
-	FrontendURL            string
-	SMTPHost               string
-	SMTPPort               string
-	SMTPFrom               string
-	SMTPUser               string
-	SMTPPass               string
+	DBHost            string
+	DBPort            string
+	DBUser            string
+	DBPassword        string
+	DBName            string
+	DBSSLMode         string
+	ServerPort        string
+	ServerEnv         string
+	SessionSecret     string
+	SessionExpiry     time.Duration
+	OIDCProviders     []OIDCProvider
+	FrontendURL       string
+	SMTPHost          string
+	SMTPPort          string
+	SMTPFrom          string
+	SMTPUser          string
+	SMTPPass          string
+	CommentMaxDepth   int
+	PostRestoreWindow time.Duration
+	WebAuthnRPID      string
+	WebAuthnRPOrigins []string
 }
 
 func Load() (*Config, error) {
@@ -41,29 +48,159 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid SESSION_EXPIRY value: %w", err)
 	}
 
+	commentMaxDepth := 5
+	if v := os.Getenv("COMMENT_MAX_DEPTH"); v != "" {
+		commentMaxDepth, err = strconv.Atoi(v)
+		if err != nil || commentMaxDepth < 0 {
+			return nil, fmt.Errorf("invalid COMMENT_MAX_DEPTH value: %q", v)
+		}
+	}
+
+	postRestoreWindow := 30 * 24 * time.Hour
+	if v := os.Getenv("POST_RESTORE_WINDOW"); v != "" {
+		postRestoreWindow, err = time.ParseDuration(v)
+		if err != nil || postRestoreWindow < 0 {
+			return nil, fmt.Errorf("invalid POST_RESTORE_WINDOW value: %q", v)
+		}
+	}
+
+	// Passkeys are bound to the frontend's domain unless configured otherwise
+	frontendURL := os.Getenv("FRONTEND_URL")
+	webAuthnRPOrigins := []string{}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			webAuthnRPOrigins = append(webAuthnRPOrigins, origin)
+		}
+	}
+	if len(webAuthnRPOrigins) == 0 && frontendURL != "" {
+		webAuthnRPOrigins = append(webAuthnRPOrigins, strings.TrimRight(frontendURL, "/"))
+	}
+	if len(webAuthnRPOrigins) == 0 {
+		return nil, fmt.Errorf("WEBAUTHN_RP_ORIGINS is required when FRONTEND_URL is not set")
+	}
+	webAuthnRPID := os.Getenv("WEBAUTHN_RP_ID")
+	if webAuthnRPID == "" {
+		origin, err := url.Parse(webAuthnRPOrigins[0])
+		if err != nil || origin.Hostname() == "" {
+			return nil, fmt.Errorf("invalid WEBAUTHN_RP_ORIGINS value: %q", webAuthnRPOrigins[0])
+		}
+		webAuthnRPID = origin.Hostname()
+	}
+
+	oidcProviders, err := loadOIDCProviders()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		DBHost:                 os.Getenv("DB_HOST"),
-		DBPort:                 os.Getenv("DB_PORT"),
-		DBUser:                 os.Getenv("DB_USER"),
-		DBPassword:             os.Getenv("DB_PASSWORD"),
-		DBName:                 os.Getenv("DB_NAME"),
-		DBSSLMode:              os.Getenv("DB_SSLMODE"),
-		ServerPort:             os.Getenv("SERVER_PORT"),
-		ServerEnv:              os.Getenv("SERVER_ENV"),
-		SessionSecret:          os.Getenv("SESSION_SECRET"),
-		SessionExpiry:          sessionExpiry,
-		GoogleClientID:         os.Getenv("GOOGLE_CLIENT_ID"),
-		GoogleClientSecret:     os.Getenv("GOOGLE_CLIENT_SECRET"),
-		GoogleOAuthRedirectURL: os.Getenv("GOOGLE_REDIRECT_URL"),
-		FrontendURL:            os.Getenv("FRONTEND_URL"),
-		SMTPHost:               os.Getenv("SMTP_HOST"),
-		SMTPPort:               os.Getenv("SMTP_PORT"),
-		SMTPFrom:               os.Getenv("SMTP_FROM"),
-		SMTPUser:               os.Getenv("SMTP_USER"),
-		SMTPPass:               os.Getenv("SMTP_PASS"),
+		DBHost:            os.Getenv("DB_HOST"),
+		DBPort:            os.Getenv("DB_PORT"),
+		DBUser:            os.Getenv("DB_USER"),
+		DBPassword:        os.Getenv("DB_PASSWORD"),
+		DBName:            os.Getenv("DB_NAME"),
+		DBSSLMode:         os.Getenv("DB_SSLMODE"),
+		ServerPort:        os.Getenv("SERVER_PORT"),
+		ServerEnv:         os.Getenv("SERVER_ENV"),
+		SessionSecret:     os.Getenv("SESSION_SECRET"),
+		SessionExpiry:     sessionExpiry,
+		OIDCProviders:     oidcProviders,
+		FrontendURL:       frontendURL,
+		SMTPHost:          os.Getenv("SMTP_HOST"),
+		SMTPPort:          os.Getenv("SMTP_PORT"),
+		SMTPFrom:          os.Getenv("SMTP_FROM"),
+		SMTPUser:          os.Getenv("SMTP_USER"),
+		SMTPPass:          os.Getenv("SMTP_PASS"),
+		CommentMaxDepth:   commentMaxDepth,
+		PostRestoreWindow: postRestoreWindow,
+		WebAuthnRPID:      webAuthnRPID,
+		WebAuthnRPOrigins: webAuthnRPOrigins,
 	}, nil
 }
 
+// OIDCProvider is an identity provider users can sign in with. Providers with an Issuer
+// are configured through OpenID Connect discovery; those without, like GitHub, are plain
+// OAuth2 servers whose endpoints are given explicitly.
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS from their
+// OIDC_<NAME>_* variables. Google is also configured through GOOGLE_* variables.
+func loadOIDCProviders() ([]OIDCProvider, error) {
+	providers := []OIDCProvider{}
+	seen := map[string]bool{}
+
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		providers = append(providers, OIDCProvider{
+			Name:         "google",
+			DisplayName:  "Google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+			Scopes:       []string{"openid", "email", "profile"},
+		})
+		seen["google"] = true
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		// These are taken by the built-in ways of signing in
+		if !providerNamePattern.MatchString(name) || name == "email" || name == "passkey" {
+			return nil, fmt.Errorf("invalid OIDC_PROVIDERS name: %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("OIDC provider %q is configured more than once", name)
+		}
+		seen[name] = true
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+			AuthURL:      os.Getenv(prefix + "AUTH_URL"),
+			TokenURL:     os.Getenv(prefix + "TOKEN_URL"),
+			UserInfoURL:  os.Getenv(prefix + "USERINFO_URL"),
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = name
+		}
+		if provider.ClientID == "" || provider.RedirectURL == "" {
+			return nil, fmt.Errorf("%sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix)
+		}
+		if provider.Issuer == "" && (provider.AuthURL == "" || provider.TokenURL == "" || provider.UserInfoURL == "") {
+			return nil, fmt.Errorf("%sISSUER, or %sAUTH_URL, %sTOKEN_URL and %sUSERINFO_URL, are required", prefix, prefix, prefix, prefix)
+		}
+		if provider.Issuer != "" && len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		} else if provider.Issuer != "" && !slices.Contains(provider.Scopes, "openid") {
+			provider.Scopes = append([]string{"openid"}, provider.Scopes...)
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
 func (c *Config) GetDBConnectionString() string {
 	return fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
@@ -0,0 +1,152 @@
+package counter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Drift is a stored counter that does not match its source table
+type Drift struct {
+	Table    string
+	ID       uuid.UUID
+	Column   string
+	Stored   int
+	Expected int
+}
+
+// check recomputes the four counters of one table. drifted selects the id, the stored
+// counters and the expected counters of every row where they differ, in the order of
+// columns; it is wrapped as a subquery d to apply the expected values.
+type check struct {
+	table   string
+	columns [4]string
+	drifted string
+}
+
+var checks = []check{
+	{
+		table:   "posts",
+		columns: [4]string{"upvotes", "downvotes", "score", "comment_count"},
+		drifted: `
+			SELECT p.id, p.upvotes, p.downvotes, p.score, p.comment_count,
+				e.upvotes, e.downvotes, e.upvotes - e.downvotes, e.comment_count
+			FROM posts p
+			CROSS JOIN LATERAL (
+				SELECT
+					(SELECT COUNT(*) FROM post_votes WHERE post_id = p.id AND vote_type = 1)::int AS upvotes,
+					(SELECT COUNT(*) FROM post_votes WHERE post_id = p.id AND vote_type = -1)::int AS downvotes,
+					(SELECT COUNT(*) FROM comments WHERE post_id = p.id AND deleted_at IS NULL)::int AS comment_count
+			) e
+			WHERE (p.upvotes, p.downvotes, p.score, p.comment_count)
+				IS DISTINCT FROM (e.upvotes, e.downvotes, e.upvotes - e.downvotes, e.comment_count)
+		`,
+	},
+	{
+		table:   "comments",
+		columns: [4]string{"upvotes", "downvotes", "score", "reply_count"},
+		drifted: `
+			SELECT c.id, c.upvotes, c.downvotes, c.score, c.reply_count,
+				e.upvotes, e.downvotes, e.upvotes - e.downvotes, e.reply_count
+			FROM comments c
+			CROSS JOIN LATERAL (
+				SELECT
+					(SELECT COUNT(*) FROM comment_votes WHERE comment_id = c.id AND vote_type = 1)::int AS upvotes,
+					(SELECT COUNT(*) FROM comment_votes WHERE comment_id = c.id AND vote_type = -1)::int AS downvotes,
+					(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id)::int AS reply_count
+			) e
+			WHERE (c.upvotes, c.downvotes, c.score, c.reply_count)
+				IS DISTINCT FROM (e.upvotes, e.downvotes, e.upvotes - e.downvotes, e.reply_count)
+		`,
+	},
+}
+
+// Repair recomputes the denormalized vote and comment counters of posts and comments from
+// their source tables and returns every counter that had drifted. With fix set the drifted
+// counters are overwritten; otherwise nothing is written.
+//
+// While fixing, writes to votes and comments wait until the repair commits, so no vote
+// is lost between recomputing and storing a counter.
+func Repair(ctx context.Context, pool *pgxpool.Pool, fix bool) ([]Drift, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if fix {
+		_, err = tx.Exec(ctx, `LOCK TABLE post_votes, comment_votes, comments IN SHARE MODE`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock source tables: %w", err)
+		}
+	}
+
+	var drifts []Drift
+	for _, c := range checks {
+		found, err := c.run(ctx, tx, fix)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, found...)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return drifts, nil
+}
+
+// run reports the drifted counters of one table, overwriting them when fix is set
+func (c check) run(ctx context.Context, tx pgx.Tx, fix bool) ([]Drift, error) {
+	query := c.drifted
+	if fix {
+		query = fmt.Sprintf(`
+			UPDATE %[1]s t
+			SET %[2]s = d.e1, %[3]s = d.e2, %[4]s = d.e3, %[5]s = d.e4
+			FROM (%[6]s) AS d(id, s1, s2, s3, s4, e1, e2, e3, e4)
+			WHERE t.id = d.id
+			RETURNING d.id, d.s1, d.s2, d.s3, d.s4, d.e1, d.e2, d.e3, d.e4
+		`, c.table, c.columns[0], c.columns[1], c.columns[2], c.columns[3], c.drifted)
+	}
+
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s counters: %w", c.table, err)
+	}
+	defer rows.Close()
+
+	var drifts []Drift
+	for rows.Next() {
+		var id uuid.UUID
+		var stored, expected [4]int
+		err := rows.Scan(&id,
+			&stored[0], &stored[1], &stored[2], &stored[3],
+			&expected[0], &expected[1], &expected[2], &expected[3],
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s counters: %w", c.table, err)
+		}
+
+		for i, column := range c.columns {
+			if stored[i] != expected[i] {
+				drifts = append(drifts, Drift{
+					Table:    c.table,
+					ID:       id,
+					Column:   column,
+					Stored:   stored[i],
+					Expected: expected[i],
+				})
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating %s counter rows: %w", c.table, err)
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,19 @@
+package counter
+
+// VoteDelta returns how the upvote and downvote counters change when a user's vote goes
+// from oldVote to newVote, where 0 means no vote
+func VoteDelta(oldVote, newVote int) (up, down int) {
+	switch oldVote {
+	case 1:
+		up--
+	case -1:
+		down--
+	}
+	switch newVote {
+	case 1:
+		up++
+	case -1:
+		down++
+	}
+	return up, down
+}
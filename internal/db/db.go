@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -23,3 +25,12 @@ func Init(connStr string) (*pgxpool.Pool, error) {
 	log.Println("Successfully connected to database")
 	return pool, nil
 }
+
+// uniqueViolation is the Postgres error code for a violated UNIQUE constraint
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err is a Postgres error for a violated UNIQUE constraint
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,146 @@
+package follow
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/pkg/response"
+)
+
+type Handler struct {
+	service *FollowService
+}
+
+func NewHandler(pool *pgxpool.Pool, notifier *notification.NotificationService) *Handler {
+	return &Handler{
+		service: NewFollowService(pool, notifier),
+	}
+}
+
+// Follow handles following the user named in the path
+func (h *Handler) Follow(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	username := r.PathValue("username")
+	if err := h.service.Follow(r.Context(), userUUID, username); err != nil {
+		switch err {
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		case ErrCannotFollowSelf:
+			response.RespondWithError(w, http.StatusBadRequest, "cannot follow yourself")
+		default:
+			log.Printf("Follow error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "user followed successfully",
+		"data": map[string]string{
+			"username": username,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// Unfollow handles unfollowing the user named in the path
+func (h *Handler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	username := r.PathValue("username")
+	if err := h.service.Unfollow(r.Context(), userUUID, username); err != nil {
+		switch err {
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		default:
+			log.Printf("Unfollow error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "user unfollowed successfully",
+		"data": map[string]string{
+			"username": username,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetFollowers handles listing the users who follow the user named in the path
+func (h *Handler) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, "followers", h.service.GetFollowers)
+}
+
+// GetFollowing handles listing the users followed by the user named in the path
+func (h *Handler) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, "following", h.service.GetFollowing)
+}
+
+type listFunc func(ctx context.Context, userID uuid.UUID, after string, limit int) ([]models.Follow, string, error)
+
+// listFollows writes one page of a followers or following list together with both counts
+func (h *Handler) listFollows(w http.ResponseWriter, r *http.Request, name string, list listFunc) {
+	userID, err := h.service.ResolveUser(r.Context(), r.PathValue("username"))
+	if err != nil {
+		switch err {
+		case ErrUserNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "user not found")
+		default:
+			log.Printf("ResolveUser error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 && limitNum <= 100 {
+			limit = limitNum
+		}
+	}
+
+	follows, nextCursor, err := list(r.Context(), userID, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		switch err {
+		case ErrInvalidCursor:
+			response.RespondWithError(w, http.StatusBadRequest, "invalid cursor")
+		default:
+			log.Printf("List %s error: %v", name, err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	counts, err := h.service.GetCounts(r.Context(), userID)
+	if err != nil {
+		log.Printf("GetCounts error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message":     name + " retrieved successfully",
+		"data":        follows,
+		"counts":      counts,
+		"next_cursor": nextCursor,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
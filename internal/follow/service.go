@@ -0,0 +1,198 @@
+package follow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+)
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrCannotFollowSelf = errors.New("cannot follow yourself")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
+
+type FollowService struct {
+	pool     *pgxpool.Pool
+	notifier *notification.NotificationService
+}
+
+func NewFollowService(pool *pgxpool.Pool, notifier *notification.NotificationService) *FollowService {
+	return &FollowService{pool: pool, notifier: notifier}
+}
+
+// Follow makes followerID follow the user named username and notifies them.
+// Following someone already followed is a no-op.
+func (s *FollowService) Follow(ctx context.Context, followerID uuid.UUID, username string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	followeeID, err := getUserID(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+	if followeeID == followerID {
+		return ErrCannotFollowSelf
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING
+	`, followerID, followeeID)
+	if err != nil {
+		return fmt.Errorf("failed to follow user: %w", err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		err = s.notifier.Notify(ctx, tx, notification.NewNotification{
+			UserID:      followeeID,
+			FromUserID:  followerID,
+			Type:        notification.TypeFollow,
+			SubjectType: notification.SubjectUser,
+			SubjectID:   followerID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Unfollow stops followerID from following the user named username.
+// Unfollowing someone not followed is a no-op.
+func (s *FollowService) Unfollow(ctx context.Context, followerID uuid.UUID, username string) error {
+	followeeID, err := getUserID(ctx, s.pool, username)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.pool.Exec(ctx, `
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followee_id = $2
+	`, followerID, followeeID)
+	if err != nil {
+		return fmt.Errorf("failed to unfollow user: %w", err)
+	}
+
+	return nil
+}
+
+// GetFollowers retrieves the users following userID, most recent first, starting after
+// the given cursor. It returns the cursor for the next page, or an empty string at the end.
+func (s *FollowService) GetFollowers(ctx context.Context, userID uuid.UUID, after string, limit int) ([]models.Follow, string, error) {
+	return s.listFollows(ctx, "followee_id", "follower_id", userID, after, limit)
+}
+
+// GetFollowing retrieves the users userID follows, most recent first, starting after
+// the given cursor. It returns the cursor for the next page, or an empty string at the end.
+func (s *FollowService) GetFollowing(ctx context.Context, userID uuid.UUID, after string, limit int) ([]models.Follow, string, error) {
+	return s.listFollows(ctx, "follower_id", "followee_id", userID, after, limit)
+}
+
+// GetCounts returns how many users follow userID and how many userID follows
+func (s *FollowService) GetCounts(ctx context.Context, userID uuid.UUID) (*models.FollowCounts, error) {
+	var counts models.FollowCounts
+	err := s.pool.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM follows WHERE followee_id = $1),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = $1)
+	`, userID).Scan(&counts.Followers, &counts.Following)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count follows: %w", err)
+	}
+	return &counts, nil
+}
+
+// ResolveUser returns the ID of the user named username
+func (s *FollowService) ResolveUser(ctx context.Context, username string) (uuid.UUID, error) {
+	return getUserID(ctx, s.pool, username)
+}
+
+// getUserID resolves a username to a user ID using db
+func getUserID(ctx context.Context, db notification.DBTX, username string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := db.QueryRow(ctx, `SELECT id FROM users WHERE username = $1`, username).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, ErrUserNotFound
+		}
+		return uuid.Nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return userID, nil
+}
+
+// listFollows lists the follows rows whose matchColumn is userID, returning the users in
+// userColumn. Both columns are fixed by the callers, never taken from input.
+func (s *FollowService) listFollows(ctx context.Context, matchColumn, userColumn string, userID uuid.UUID, after string, limit int) ([]models.Follow, string, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	// Without a cursor, start from a point later than any stored follow
+	beforeTime := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	beforeID := uuid.Max
+	if after != "" {
+		c, err := cursor.Parse(after)
+		if err != nil || c.Backward {
+			return nil, "", ErrInvalidCursor
+		}
+		beforeTime, beforeID = c.Time, c.ID
+	}
+
+	// Fetch one extra row to know whether another page follows
+	rows, err := s.pool.Query(ctx, `
+		SELECT f.`+userColumn+`, u.username, f.created_at
+		FROM follows f
+		JOIN users u ON f.`+userColumn+` = u.id
+		WHERE f.`+matchColumn+` = $1
+		  AND (f.created_at, f.`+userColumn+`) < ($2, $3)
+		ORDER BY f.created_at DESC, f.`+userColumn+` DESC
+		LIMIT $4
+	`, userID, beforeTime, beforeID, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query follows: %w", err)
+	}
+	defer rows.Close()
+
+	follows := []models.Follow{}
+	for rows.Next() {
+		var f models.Follow
+		var username string
+		if err := rows.Scan(&f.UserID, &username, &f.FollowedAt); err != nil {
+			return nil, "", fmt.Errorf("failed to scan follow row: %w", err)
+		}
+		f.User = &models.UserBasic{
+			Username: username,
+		}
+		follows = append(follows, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating follow rows: %w", err)
+	}
+
+	nextCursor := ""
+	if len(follows) > limit {
+		follows = follows[:limit]
+		last := follows[len(follows)-1]
+		nextCursor = cursor.After(last.FollowedAt, 0, last.UserID).String()
+	}
+
+	return follows, nextCursor, nil
+}
@@ -0,0 +1,74 @@
+package mention
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/thediligencedev/betteridn/internal/models"
+)
+
+// maxMentions caps how many distinct users a single body can mention
+const maxMentions = 20
+
+// mentionPattern matches @username at the start of the text or after a character that
+// cannot be part of a username or email address. Usernames may contain dots and hyphens
+// but not end with them, so "@bob." mentions bob.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@.])@([A-Za-z0-9_](?:[A-Za-z0-9_.-]*[A-Za-z0-9_])?)`)
+
+// Parse returns every @username token in text, in order of appearance
+func Parse(text string) []models.Mention {
+	matches := mentionPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	spans := make([]models.Mention, 0, len(matches))
+	offset := 0
+	bytePos := 0
+	for _, m := range matches {
+		// m[2]:m[3] is the username; the @ sits right before it
+		start, end := m[2]-1, m[3]
+		offset += utf16Len(text[bytePos:start])
+		startUnits := offset
+		offset += utf16Len(text[start:end])
+		bytePos = end
+
+		spans = append(spans, models.Mention{
+			Username: text[m[2]:m[3]],
+			Start:    startUnits,
+			End:      offset,
+		})
+	}
+	return spans
+}
+
+// Usernames returns the distinct lower-cased usernames mentioned in text, up to maxMentions
+func Usernames(text string) []string {
+	seen := make(map[string]struct{})
+	names := []string{}
+	for _, span := range Parse(text) {
+		name := strings.ToLower(span.Username)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+		if len(names) == maxMentions {
+			break
+		}
+	}
+	return names
+}
+
+// utf16Len counts the UTF-16 code units needed to encode s
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		n += utf16.RuneLen(r)
+		s = s[size:]
+	}
+	return n
+}
@@ -0,0 +1,158 @@
+package mention
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+)
+
+// Subject types, matching the CHECK constraint on mentions.subject_type
+const (
+	SubjectPost    = "post"
+	SubjectComment = "comment"
+)
+
+type MentionService struct {
+	pool     *pgxpool.Pool
+	notifier *notification.NotificationService
+}
+
+func NewMentionService(pool *pgxpool.Pool, notifier *notification.NotificationService) *MentionService {
+	return &MentionService{pool: pool, notifier: notifier}
+}
+
+// Sync stores the users mentioned in content for a post or comment, dropping mentions that
+// were edited out, and sends a mention notification to each user who was not mentioned
+// before. Usernames that do not belong to any user are ignored. postID is included in the
+// notification data so clients can link to the thread.
+func (s *MentionService) Sync(ctx context.Context, tx pgx.Tx, subjectType string, subjectID, postID, authorID uuid.UUID, content string) error {
+	userIDs := []uuid.UUID{}
+	if names := Usernames(content); len(names) > 0 {
+		rows, err := tx.Query(ctx, `
+			SELECT id FROM users WHERE LOWER(username) = ANY($1)
+		`, names)
+		if err != nil {
+			return fmt.Errorf("failed to resolve mentions: %w", err)
+		}
+		userIDs, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return fmt.Errorf("failed to scan mentioned users: %w", err)
+		}
+	}
+
+	_, err := tx.Exec(ctx, `
+		DELETE FROM mentions
+		WHERE subject_type = $1 AND subject_id = $2 AND NOT (user_id = ANY($3))
+	`, subjectType, subjectID, userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to remove mentions: %w", err)
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	// RETURNING only yields rows that were actually inserted, i.e. new mentions
+	rows, err := tx.Query(ctx, `
+		INSERT INTO mentions (subject_type, subject_id, user_id, mentioned_by)
+		SELECT $1, $2, unnest($3::uuid[]), $4
+		ON CONFLICT (subject_type, subject_id, user_id) DO NOTHING
+		RETURNING user_id
+	`, subjectType, subjectID, userIDs, authorID)
+	if err != nil {
+		return fmt.Errorf("failed to store mentions: %w", err)
+	}
+	added, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to scan new mentions: %w", err)
+	}
+
+	for _, userID := range added {
+		err := s.notifier.Notify(ctx, tx, notification.NewNotification{
+			UserID:      userID,
+			FromUserID:  authorID,
+			Type:        notification.TypeMention,
+			SubjectType: subjectType,
+			SubjectID:   subjectID,
+			Data:        map[string]any{"post_id": postID},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Clear removes every mention stored for a post or comment
+func (s *MentionService) Clear(ctx context.Context, tx pgx.Tx, subjectType string, subjectID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM mentions
+		WHERE subject_type = $1 AND subject_id = $2
+	`, subjectType, subjectID)
+	if err != nil {
+		return fmt.Errorf("failed to clear mentions: %w", err)
+	}
+	return nil
+}
+
+// Spans returns the mention spans of several posts or comments of the same subject type,
+// keyed by subject ID. contents maps each subject ID to its body. Only tokens naming a
+// stored mention are returned, so unknown usernames are never linked.
+func (s *MentionService) Spans(ctx context.Context, subjectType string, contents map[uuid.UUID]string) (map[uuid.UUID][]models.Mention, error) {
+	spans := make(map[uuid.UUID][]models.Mention, len(contents))
+
+	subjectIDs := make([]uuid.UUID, 0, len(contents))
+	for id, content := range contents {
+		// Skip the lookup for bodies without any @ token
+		if strings.Contains(content, "@") {
+			subjectIDs = append(subjectIDs, id)
+		}
+	}
+	if len(subjectIDs) == 0 {
+		return spans, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT m.subject_id, LOWER(u.username)
+		FROM mentions m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.subject_type = $1 AND m.subject_id = ANY($2)
+	`, subjectType, subjectIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mentions: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[uuid.UUID]map[string]struct{})
+	for rows.Next() {
+		var subjectID uuid.UUID
+		var username string
+		if err := rows.Scan(&subjectID, &username); err != nil {
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		if known[subjectID] == nil {
+			known[subjectID] = make(map[string]struct{})
+		}
+		known[subjectID][username] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mention rows: %w", err)
+	}
+
+	for subjectID, usernames := range known {
+		for _, span := range Parse(contents[subjectID]) {
+			if _, ok := usernames[strings.ToLower(span.Username)]; ok {
+				spans[subjectID] = append(spans[subjectID], span)
+			}
+		}
+	}
+
+	return spans, nil
+}
@@ -0,0 +1,8 @@
+package models
+
+// AuthProvider is an identity provider users can sign in with. LoginURL starts the sign in.
+type AuthProvider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
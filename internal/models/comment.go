@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeletedCommentPlaceholder replaces the content of a deleted comment that still has replies
+const DeletedCommentPlaceholder = "[deleted]"
+
+type Comment struct {
+	ID            uuid.UUID  `db:"id" json:"id"`
+	PostID        uuid.UUID  `db:"post_id" json:"post_id"`
+	ParentID      *uuid.UUID `db:"parent_id" json:"parent_id,omitempty"`
+	Depth         int        `db:"depth" json:"depth"`
+	Content       string     `db:"content" json:"content"`
+	ContentHTML   string     `json:"content_html"`
+	IsDeleted     bool       `json:"is_deleted"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+	User          *UserBasic `json:"user,omitempty"`
+	VoteCount     *VoteCount `json:"vote_count,omitempty"`
+	Mentions      []Mention  `json:"mentions,omitempty"`
+	ReplyCount    int        `json:"reply_count"`
+	Replies       []*Comment `json:"replies,omitempty"`
+	RepliesCursor string     `json:"replies_cursor,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Follow is one entry of a followers or following list
+type Follow struct {
+	UserID     uuid.UUID  `db:"user_id" json:"-"`
+	User       *UserBasic `json:"user"`
+	FollowedAt time.Time  `db:"created_at" json:"followed_at"`
+}
+
+type FollowCounts struct {
+	Followers int `json:"followers"`
+	Following int `json:"following"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// Mention is an @username reference inside a post or comment body. Start and End are
+// UTF-16 code unit offsets of the whole "@username" token, matching JavaScript string indexes.
+type Mention struct {
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
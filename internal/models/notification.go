@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Notification struct {
+	ID          uuid.UUID       `db:"id" json:"id"`
+	Type        string          `db:"type" json:"type"`
+	SubjectType string          `db:"subject_type" json:"subject_type"`
+	SubjectID   uuid.UUID       `db:"subject_id" json:"subject_id"`
+	Data        json.RawMessage `db:"data" json:"data,omitempty"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	ReadAt      *time.Time      `db:"read_at" json:"read_at,omitempty"`
+	FromUser    *UserBasic      `json:"from_user,omitempty"`
+}
@@ -6,15 +6,36 @@ import (
 	"github.com/google/uuid"
 )
 
+// Post statuses. Only published posts are visible to users other than the author.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// DeletedPostPlaceholder replaces the title and content of a deleted post
+const DeletedPostPlaceholder = "[deleted]"
+
 type Post struct {
-	ID         uuid.UUID  `db:"id" json:"id"`
-	Title      string     `db:"title" json:"title"`
-	Content    string     `db:"content" json:"content"`
-	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
-	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
-	Categories []string   `json:"categories,omitempty"`
-	User       *UserBasic `json:"user,omitempty"`
-	VoteCount  *VoteCount `json:"vote_count,omitempty"`
+	ID           uuid.UUID  `db:"id" json:"id"`
+	Title        string     `db:"title" json:"title"`
+	Content      string     `db:"content" json:"content"`
+	ContentHTML  string     `json:"content_html"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+	Categories   []string   `json:"categories,omitempty"`
+	User         *UserBasic `json:"user,omitempty"`
+	VoteCount    *VoteCount `json:"vote_count,omitempty"`
+	CommentCount int        `json:"comment_count"`
+	MyVote       *int       `json:"my_vote,omitempty"`
+	Mentions     []Mention  `json:"mentions,omitempty"`
+	Status       string     `json:"status"`
+	PublishAt    *time.Time `json:"publish_at,omitempty"`
+	Version      int        `json:"version"`
+	Edited       bool       `json:"edited"`
+	EditedAt     *time.Time `json:"edited_at,omitempty"`
+	IsDeleted    bool       `json:"is_deleted"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
 }
 
 type UserBasic struct {
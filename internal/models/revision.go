@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/thediligencedev/betteridn/pkg/diff"
+)
+
+// Revision is one version of an edited post or comment. Revisions are numbered from 1,
+// and the current version is the last one. Comments have no title or categories.
+type Revision struct {
+	Revision   int       `json:"revision"`
+	Title      string    `json:"title,omitempty"`
+	Content    string    `json:"content"`
+	Categories []string  `json:"categories,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"`
+}
+
+// RevisionDiff describes the changes between two revisions
+type RevisionDiff struct {
+	From              int         `json:"from"`
+	To                int         `json:"to"`
+	Title             []diff.Line `json:"title,omitempty"`
+	Content           []diff.Line `json:"content"`
+	CategoriesAdded   []string    `json:"categories_added,omitempty"`
+	CategoriesRemoved []string    `json:"categories_removed,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of search results
+const (
+	SearchResultPost    = "post"
+	SearchResultComment = "comment"
+)
+
+// SearchResult is a post or comment matching a search. Title is the title of the post,
+// or of the post a comment was made on. Snippet is HTML with matched terms in <mark>.
+type SearchResult struct {
+	Type      string     `json:"type"`
+	PostID    uuid.UUID  `json:"post_id"`
+	CommentID *uuid.UUID `json:"comment_id,omitempty"`
+	Title     string     `json:"title"`
+	Snippet   string     `json:"snippet"`
+	User      *UserBasic `json:"user"`
+	CreatedAt time.Time  `json:"created_at"`
+	Rank      float64    `json:"rank"`
+}
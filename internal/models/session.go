@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ways of signing in, recorded for each session. Sessions started through an identity
+// provider record the provider's name instead.
+const (
+	LoginMethodPassword = "password"
+	LoginMethodPasskey  = "passkey"
+)
+
+// Session describes one signed-in session of a user. Current marks the session of the
+// request listing it.
+type Session struct {
+	ID          uuid.UUID `json:"id"`
+	LoginMethod string    `json:"login_method"`
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	Current     bool      `json:"current"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// TwoFactorSetup is what a user needs to add their account to an authenticator app.
+// QRCode is a PNG data URI encoding URI.
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode string `json:"qr_code"`
+}
@@ -1,18 +1,21 @@
 package models
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/pgtype"
+	"github.com/thediligencedev/betteridn/pkg/response"
 )
 
 type User struct {
 	ID               uuid.UUID    `db:"id" json:"id"`
 	Username         string       `db:"username" json:"username"`
 	Email            string       `db:"email" json:"email"`
-	Password         string       `db:"password" json:"-"`
+	Password         *string      `db:"password" json:"-"` // NULL for OAuth accounts without a password
 	IsEmailConfirmed bool         `db:"is_email_confirmed" json:"is_email_confirmed"`
+	Role             string       `db:"role" json:"role"`
 	Bio              string       `db:"bio" json:"bio,omitempty"`
 	AvatarURL        string       `db:"avatar_url" json:"avatar_url,omitempty"`
 	Preferences      pgtype.JSONB `db:"preferences" json:"preferences,omitempty"`
@@ -21,8 +24,32 @@ type User struct {
 	UpdatedAt        time.Time    `db:"updated_at" json:"updated_at"`
 }
 
+// User roles, matching the CHECK constraint on users.role
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 // to avoid naming collisions in context
 // and to store scs session inside golang context
 type contextKey string
 
 const UserContextKey contextKey = "user_id"
+
+// UserIDFromContext reads the user ID set by the WithAuth middleware,
+// writing an error response and returning false if it is missing or malformed
+func UserIDFromContext(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, ok := r.Context().Value(UserContextKey).(string)
+	if !ok || userID == "" {
+		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, false
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid user ID")
+		return uuid.Nil, false
+	}
+	return userUUID, true
+}
@@ -0,0 +1,174 @@
+package notification
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/pkg/response"
+)
+
+type Handler struct {
+	service *NotificationService
+}
+
+func NewHandler(pool *pgxpool.Pool) *Handler {
+	return &Handler{
+		service: NewNotificationService(pool),
+	}
+}
+
+// GetNotifications handles listing the current user's notifications with cursor pagination
+func (h *Handler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 && limitNum <= 100 {
+			limit = limitNum
+		}
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, nextCursor, err := h.service.GetNotifications(r.Context(), userUUID, r.URL.Query().Get("cursor"), limit, unreadOnly)
+	if err != nil {
+		switch err {
+		case ErrInvalidCursor:
+			response.RespondWithError(w, http.StatusBadRequest, "invalid cursor")
+		default:
+			log.Printf("GetNotifications error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message":     "notifications retrieved successfully",
+		"data":        notifications,
+		"next_cursor": nextCursor,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetUnreadCount handles returning the number of unread notifications
+func (h *Handler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := h.service.GetUnreadCount(r.Context(), userUUID)
+	if err != nil {
+		log.Printf("GetUnreadCount error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "unread count retrieved successfully",
+		"data": map[string]int{
+			"unread_count": count,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// MarkAsRead handles marking a single notification as read
+func (h *Handler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	notificationID, err := uuid.Parse(r.PathValue("notificationId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid notification ID format")
+		return
+	}
+
+	if err := h.service.MarkAsRead(r.Context(), userUUID, notificationID); err != nil {
+		switch err {
+		case ErrNotificationNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "notification not found")
+		default:
+			log.Printf("MarkAsRead error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "notification marked as read",
+		"data": map[string]string{
+			"id": notificationID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// MarkAllAsRead handles marking every unread notification as read
+func (h *Handler) MarkAllAsRead(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.service.MarkAllAsRead(r.Context(), userUUID)
+	if err != nil {
+		log.Printf("MarkAllAsRead error: %v", err)
+		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "all notifications marked as read",
+		"data": map[string]int64{
+			"updated": updated,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// DeleteNotification handles removing a notification from the inbox
+func (h *Handler) DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	notificationID, err := uuid.Parse(r.PathValue("notificationId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid notification ID format")
+		return
+	}
+
+	if err := h.service.DeleteNotification(r.Context(), userUUID, notificationID); err != nil {
+		switch err {
+		case ErrNotificationNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "notification not found")
+		default:
+			log.Printf("DeleteNotification error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "notification deleted successfully",
+		"data": map[string]string{
+			"id": notificationID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
@@ -0,0 +1,321 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+)
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+)
+
+// Notification types, matching the CHECK constraint on notifications.type
+const (
+	TypePostLike    = "post_like"
+	TypeCommentLike = "comment_like"
+	TypeNewComment  = "new_comment"
+	TypeMention     = "mention"
+	TypeFollow      = "follow"
+	TypeNewPost     = "new_post"
+)
+
+// Subject types, matching the CHECK constraint on notifications.subject_type
+const (
+	SubjectPost    = "post"
+	SubjectComment = "comment"
+	SubjectUser    = "user"
+)
+
+// ChannelNotifications is the Postgres NOTIFY channel announcing new notifications.
+// Its payload is a ChannelPayload.
+const ChannelNotifications = "notifications"
+
+// ChannelPayload announces a stored notification; listeners load it with GetNotification
+type ChannelPayload struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// DBTX is satisfied by both *pgxpool.Pool and pgx.Tx, so notifications can be
+// written inside the transaction of the action that triggers them
+type DBTX interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// notificationColumns is the select list shared by notification queries; scan it with scanNotification
+const notificationColumns = `
+	n.id, n.type, n.subject_type, n.subject_id, n.data, n.created_at, n.read_at, u.username
+`
+
+// NewNotification describes a notification to deliver to UserID about an action by FromUserID
+type NewNotification struct {
+	UserID      uuid.UUID
+	FromUserID  uuid.UUID
+	Type        string
+	SubjectType string
+	SubjectID   uuid.UUID
+	Data        map[string]any
+}
+
+type NotificationService struct {
+	pool *pgxpool.Pool
+}
+
+func NewNotificationService(pool *pgxpool.Pool) *NotificationService {
+	return &NotificationService{pool: pool}
+}
+
+// Notify stores a notification using db and announces it on ChannelNotifications. When db is
+// a transaction the announcement is only delivered if it commits. Self-actions are ignored,
+// as is a repeat of an identical notification the recipient has not read yet (e.g. toggling a vote).
+func (s *NotificationService) Notify(ctx context.Context, db DBTX, n NewNotification) error {
+	if n.UserID == n.FromUserID {
+		return nil
+	}
+
+	data := n.Data
+	if data == nil {
+		data = map[string]any{}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification data: %w", err)
+	}
+
+	var notificationID uuid.UUID
+	err = db.QueryRow(ctx, `
+		INSERT INTO notifications (user_id, from_user_id, type, subject_type, subject_id, data)
+		SELECT $1, $2, $3, $4, $5, $6
+		WHERE NOT EXISTS (
+			SELECT 1 FROM notifications
+			WHERE user_id = $1 AND from_user_id = $2 AND type = $3 AND subject_id = $5
+			  AND read_at IS NULL AND is_deleted = false
+		)
+		RETURNING id
+	`, n.UserID, n.FromUserID, n.Type, n.SubjectType, n.SubjectID, dataJSON).Scan(&notificationID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// An identical unread notification already exists
+			return nil
+		}
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	payload, err := json.Marshal(ChannelPayload{ID: notificationID, UserID: n.UserID})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification payload: %w", err)
+	}
+	_, err = db.Exec(ctx, `SELECT pg_notify($1, $2)`, ChannelNotifications, string(payload))
+	if err != nil {
+		return fmt.Errorf("failed to publish notification: %w", err)
+	}
+	return nil
+}
+
+// GetNotification retrieves a single notification by ID, including deleted ones
+func (s *NotificationService) GetNotification(ctx context.Context, notificationID uuid.UUID) (*models.Notification, error) {
+	row := s.pool.QueryRow(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications n
+		JOIN users u ON n.from_user_id = u.id
+		WHERE n.id = $1
+	`, notificationID)
+
+	n, err := scanNotification(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotificationNotFound
+		}
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+	return n, nil
+}
+
+// GetNotificationsSince retrieves up to limit of a user's notifications created after the
+// given cursor, oldest first, so a client can catch up on what it missed
+func (s *NotificationService) GetNotificationsSince(ctx context.Context, userID uuid.UUID, after string, limit int) ([]models.Notification, error) {
+	c, err := cursor.Parse(after)
+	if err != nil || c.Backward {
+		return nil, ErrInvalidCursor
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications n
+		JOIN users u ON n.from_user_id = u.id
+		WHERE n.user_id = $1
+		  AND n.is_deleted = false
+		  AND (n.created_at, n.id) > ($2, $3)
+		ORDER BY n.created_at ASC, n.id ASC
+		LIMIT $4
+	`, userID, c.Time, c.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+
+	return collectNotifications(rows)
+}
+
+// GetNotifications retrieves a user's notifications, newest first, starting after the
+// given cursor. It returns the cursor for the next page, or an empty string at the end.
+func (s *NotificationService) GetNotifications(ctx context.Context, userID uuid.UUID, after string, limit int, unreadOnly bool) ([]models.Notification, string, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	// Without a cursor, start from a point later than any stored notification
+	beforeTime := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	beforeID := uuid.Max
+	if after != "" {
+		c, err := cursor.Parse(after)
+		if err != nil || c.Backward {
+			return nil, "", ErrInvalidCursor
+		}
+		beforeTime, beforeID = c.Time, c.ID
+	}
+
+	// Fetch one extra row to know whether another page follows
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications n
+		JOIN users u ON n.from_user_id = u.id
+		WHERE n.user_id = $1
+		  AND n.is_deleted = false
+		  AND (NOT $2 OR n.read_at IS NULL)
+		  AND (n.created_at, n.id) < ($3, $4)
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $5
+	`, userID, unreadOnly, beforeTime, beforeID, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query notifications: %w", err)
+	}
+
+	notifications, err := collectNotifications(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[len(notifications)-1]
+		nextCursor = cursor.After(last.CreatedAt, 0, last.ID).String()
+	}
+
+	return notifications, nextCursor, nil
+}
+
+// GetUnreadCount returns the number of unread notifications for a user
+func (s *NotificationService) GetUnreadCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := s.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL AND is_deleted = false
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkAsRead marks a single notification as read. Already-read notifications keep their read time.
+func (s *NotificationService) MarkAsRead(ctx context.Context, userID, notificationID uuid.UUID) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2 AND is_deleted = false
+	`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllAsRead marks every unread notification of a user as read and returns how many changed
+func (s *NotificationService) MarkAllAsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL AND is_deleted = false
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteNotification soft-deletes a notification so it no longer appears in the inbox
+func (s *NotificationService) DeleteNotification(ctx context.Context, userID, notificationID uuid.UUID) error {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE notifications
+		SET is_deleted = true
+		WHERE id = $1 AND user_id = $2 AND is_deleted = false
+	`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// scanNotification scans a row selected with notificationColumns
+func scanNotification(row pgx.Row) (*models.Notification, error) {
+	var n models.Notification
+	var username string
+
+	err := row.Scan(
+		&n.ID,
+		&n.Type,
+		&n.SubjectType,
+		&n.SubjectID,
+		&n.Data,
+		&n.CreatedAt,
+		&n.ReadAt,
+		&username,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	n.FromUser = &models.UserBasic{
+		Username: username,
+	}
+	return &n, nil
+}
+
+// collectNotifications scans and closes rows selected with notificationColumns
+func collectNotifications(rows pgx.Rows) ([]models.Notification, error) {
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification row: %w", err)
+		}
+		notifications = append(notifications, *n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification rows: %w", err)
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,189 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort, must be one of new, top, hot")
+	ErrInvalidPeriod = errors.New("invalid period, must be one of day, week, month, all")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Sort modes for post listings
+const (
+	SortNew = "new"
+	SortTop = "top"
+	SortHot = "hot"
+)
+
+// Periods limiting which posts are ranked by SortTop
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+// periodIntervals maps a period to the Postgres interval it covers; PeriodAll has no bound
+var periodIntervals = map[string]string{
+	PeriodDay:   "1 day",
+	PeriodWeek:  "7 days",
+	PeriodMonth: "1 month",
+	PeriodAll:   "",
+}
+
+// postScore is a post's upvotes minus downvotes, kept up to date by VotePost
+const postScore = "p.score"
+
+// postHotness ranks by score with a time decay: every 12.5 hours of recency is worth
+// as much as ten times the votes, so new posts can overtake older popular ones.
+// It only depends on the post itself, so a post's rank is stable between requests.
+const postHotness = `(SIGN(p.score) * LOG(GREATEST(ABS(p.score), 1))
+	+ EXTRACT(EPOCH FROM p.created_at) / 45000)::float8`
+
+// postSort describes how a sort mode orders posts. Rows are ordered by key descending,
+// with the id as tie-breaker, so (key, id) is the keyset a cursor points into.
+// Ranked sorts key on a float8 score; time-ordered sorts key on created_at.
+type postSort struct {
+	key    string
+	byTime bool
+}
+
+var postSorts = map[string]postSort{
+	SortNew: {key: "p.created_at", byTime: true},
+	SortTop: {key: postScore + "::float8"},
+	SortHot: {key: postHotness},
+}
+
+// score returns the select expression for the score stored in cursors
+func (ps postSort) score() string {
+	if ps.byTime {
+		return "0::float8"
+	}
+	return ps.key
+}
+
+// orderBy returns the ORDER BY clause, reversed when paging backwards
+func (ps postSort) orderBy(backward bool) string {
+	direction := "DESC"
+	if backward {
+		direction = "ASC"
+	}
+	return ps.key + " " + direction + ", p.id " + direction
+}
+
+// after builds the keyset condition selecting the rows past c in its direction,
+// appending its parameters to args
+func (ps postSort) after(c cursor.Cursor, args []any) (string, []any) {
+	op := "<"
+	if c.Backward {
+		op = ">"
+	}
+
+	var key any = c.Score
+	if ps.byTime {
+		key = c.Time
+	}
+
+	args = append(args, key, c.ID)
+	return fmt.Sprintf("(%s, p.id) %s ($%d, $%d)", ps.key, op, len(args)-1, len(args)), args
+}
+
+// PostFilter narrows and orders a post listing. Zero values mean no filtering,
+// newest first.
+type PostFilter struct {
+	Categories []string   `json:"categories,omitempty"`
+	Author     string     `json:"author,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+	Sort       string     `json:"sort"`
+	Period     string     `json:"period,omitempty"`
+	Status     string     `json:"status"`
+
+	// FollowedBy limits the listing to authors followed by this user, for the feed
+	FollowedBy *uuid.UUID `json:"-"`
+
+	// viewer is the signed-in user; unpublished posts are only listed for their author
+	viewer uuid.UUID
+}
+
+// normalize fills in defaults and validates the sort mode, period and status
+func (f *PostFilter) normalize() error {
+	if f.Status == "" {
+		f.Status = models.PostStatusPublished
+	}
+	switch f.Status {
+	case models.PostStatusDraft, models.PostStatusScheduled, models.PostStatusPublished:
+	default:
+		return ErrInvalidStatus
+	}
+
+	if f.Sort == "" {
+		f.Sort = SortNew
+	}
+	if _, ok := postSorts[f.Sort]; !ok {
+		return ErrInvalidSort
+	}
+
+	if f.Sort != SortTop {
+		// Only top listings are ranked over a period
+		f.Period = ""
+		return nil
+	}
+	if f.Period == "" {
+		f.Period = PeriodAll
+	}
+	if _, ok := periodIntervals[f.Period]; !ok {
+		return ErrInvalidPeriod
+	}
+	return nil
+}
+
+// where builds the WHERE clause for the filter, appending its parameters to args.
+// Deleted posts are never listed. Queries must alias posts as p and the author as u.
+func (f *PostFilter) where(args []any) (string, []any) {
+	conds := []string{"p.deleted_at IS NULL"}
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conds = append(conds, "p.status = "+param(f.Status))
+	if f.Status != models.PostStatusPublished {
+		conds = append(conds, "p.user_id = "+param(f.viewer))
+	}
+
+	if len(f.Categories) > 0 {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM post_categories pc
+			JOIN categories c ON pc.category_id = c.id
+			WHERE pc.post_id = p.id AND c.slug = ANY(`+param(f.Categories)+`)
+		)`)
+	}
+	if f.FollowedBy != nil {
+		conds = append(conds, "p.user_id IN (SELECT followee_id FROM follows WHERE follower_id = "+param(*f.FollowedBy)+")")
+	}
+	if f.Author != "" {
+		conds = append(conds, "u.username = "+param(f.Author))
+	}
+	if f.From != nil {
+		conds = append(conds, "p.created_at >= "+param(*f.From))
+	}
+	if f.To != nil {
+		conds = append(conds, "p.created_at < "+param(*f.To))
+	}
+	if interval := periodIntervals[f.Period]; interval != "" {
+		conds = append(conds, "p.created_at >= NOW() - "+param(interval)+"::interval")
+	}
+
+	return strings.Join(conds, " AND "), args
+}
@@ -2,38 +2,55 @@ package post
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/revision"
 	"github.com/thediligencedev/betteridn/pkg/response"
 	"github.com/thediligencedev/betteridn/pkg/validator"
 )
 
+// maxPostBodyBytes caps the request body of creating and updating a post. Content is
+// limited to 40000 characters by validation, which keeps revisions cheap to store and diff.
+const maxPostBodyBytes = 1 << 20
+
 type Handler struct {
 	service *PostService
 }
 
-func NewHandler(pool *pgxpool.Pool) *Handler {
+func NewHandler(service *PostService) *Handler {
 	return &Handler{
-		service: NewPostService(pool),
+		service: service,
 	}
 }
 
 // TODO: if still error, change categories to type interface{} so can get both array and string
 type CreatePostRequest struct {
-	Title      string   `json:"title" validate:"required"`
-	Content    string   `json:"content" validate:"required"`
-	Categories []string `json:"categories" validate:"required,min=1"`
+	Title      string     `json:"title" validate:"required"`
+	Content    string     `json:"content" validate:"required,max=40000"`
+	Categories []string   `json:"categories" validate:"required,min=1"`
+	Status     string     `json:"status,omitempty" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at,omitempty"`
 }
 
 type UpdatePostRequest struct {
 	Title      string   `json:"title" validate:"required"`
-	Content    string   `json:"content" validate:"required"`
+	Content    string   `json:"content" validate:"required,max=40000"`
 	Categories []string `json:"categories" validate:"required,min=1"`
+	// Version is the version being edited, for clients that cannot send If-Match
+	Version int `json:"version,omitempty" validate:"omitempty,min=1"`
+}
+
+type PublishPostRequest struct {
+	PublishAt *time.Time `json:"publish_at,omitempty"`
 }
 
 type VotePostRequest struct {
@@ -49,27 +66,14 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	// println(r.Context().Value(models.UserContextKey))
 
-	// Get user ID from context
-	userIDRaw := r.Context().Value(models.UserContextKey)
-	if userIDRaw == nil {
-		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized: user_id not found in session")
-		return
-	}
-
-	userID, ok := userIDRaw.(string)
-	if !ok || userID == "" {
-		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized: invalid user_id in session")
-		return
-	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		response.RespondWithError(w, http.StatusBadRequest, "invalid user ID")
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
 		return
 	}
 
 	// Parse request body
 	var req CreatePostRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostBodyBytes)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
 		return
@@ -82,9 +86,11 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create post
-	postID, err := h.service.CreatePost(r.Context(), userUUID, req.Title, req.Content, req.Categories)
+	postID, err := h.service.CreatePost(r.Context(), userUUID, req.Title, req.Content, req.Categories, req.Status, req.PublishAt)
 	if err != nil {
 		switch err {
+		case ErrInvalidStatus, ErrInvalidPublishAt:
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
 		case ErrCategoryNotFound:
 			response.RespondWithError(w, http.StatusBadRequest, "one or more categories not found")
 		case ErrValidationFailed:
@@ -113,6 +119,35 @@ func (h *Handler) GetPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.listPosts(w, r, filter, "posts retrieved successfully")
+}
+
+// GetFeed handles retrieving a paginated list of posts from the users the current user follows
+func (h *Handler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := parsePostFilter(r)
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.FollowedBy = &userUUID
+
+	h.listPosts(w, r, filter, "feed retrieved successfully")
+}
+
+// listPosts writes one page of posts matching filter. The page is selected by the
+// cursor query parameter, or by page for clients that paginate by offset.
+func (h *Handler) listPosts(w http.ResponseWriter, r *http.Request, filter PostFilter, message string) {
 	// Parse pagination parameters
 	page := 1
 	limit := 20
@@ -130,17 +165,28 @@ func (h *Handler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get posts
-	posts, err := h.service.GetPosts(r.Context(), page, limit)
+	result, err := h.service.GetPosts(r.Context(), filter, r.URL.Query().Get("cursor"), page, limit, viewerFromContext(r))
 	if err != nil {
-		log.Printf("GetPosts error: %v", err)
-		response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		switch err {
+		case ErrInvalidSort, ErrInvalidPeriod, ErrInvalidStatus, ErrInvalidCursor:
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		case ErrSignInRequired:
+			response.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		default:
+			log.Printf("GetPosts error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
 		return
 	}
 
 	// Success
 	responseJSON := map[string]interface{}{
-		"message": "posts retrieved successfully",
-		"data":    posts,
+		"message":     message,
+		"data":        result.Posts,
+		"filters":     filter,
+		"total":       result.Total,
+		"next_cursor": result.NextCursor,
+		"prev_cursor": result.PrevCursor,
 	}
 	response.RespondWithJSON(w, http.StatusOK, responseJSON)
 }
@@ -176,11 +222,17 @@ func (h *Handler) GetPostByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get post
-	post, err := h.service.GetPostByID(r.Context(), postID)
+	post, err := h.service.GetPostByID(r.Context(), postID, viewerFromContext(r))
 	if err != nil {
 		switch err {
 		case ErrPostNotFound:
 			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			// The tombstone lets threads keep a placeholder for the post
+			response.RespondWithJSON(w, http.StatusGone, map[string]interface{}{
+				"message": "post has been deleted",
+				"data":    post,
+			})
 		default:
 			log.Printf("GetPostByID error: %v", err)
 			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
@@ -189,6 +241,7 @@ func (h *Handler) GetPostByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success
+	w.Header().Set("ETag", etag(post.Version))
 	responseJSON := map[string]interface{}{
 		"message": "post retrieved successfully",
 		"data":    post,
@@ -203,16 +256,8 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from context
-	userID := r.Context().Value(models.UserContextKey).(string)
-	if userID == "" {
-		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
-		return
-	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		response.RespondWithError(w, http.StatusBadRequest, "invalid user ID")
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
 		return
 	}
 
@@ -240,6 +285,7 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var req UpdatePostRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostBodyBytes)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
 		return
@@ -251,12 +297,38 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The client must say which version it edited so it cannot overwrite a newer one.
+	// If-Match takes precedence over the version field; If-Match: * skips the check.
+	version := req.Version
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" {
+		var ok bool
+		if version, ok = parseIfMatch(ifMatch); !ok {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid If-Match header")
+			return
+		}
+	} else if version == 0 {
+		response.RespondWithError(w, http.StatusPreconditionRequired, "If-Match header or version is required")
+		return
+	}
+
 	// Update post
-	err = h.service.UpdatePost(r.Context(), postID, userUUID, req.Title, req.Content, req.Categories)
+	newVersion, err := h.service.UpdatePost(r.Context(), postID, userUUID, version, req.Title, req.Content, req.Categories)
 	if err != nil {
 		switch err {
+		case ErrVersionMismatch:
+			w.Header().Set("ETag", etag(newVersion))
+			response.RespondWithJSON(w, http.StatusPreconditionFailed, map[string]interface{}{
+				"message": "post has been modified since it was loaded",
+				"data": map[string]interface{}{
+					"id":      postID.String(),
+					"version": newVersion,
+				},
+			})
 		case ErrPostNotFound:
 			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
 		case ErrUnauthorized:
 			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to update this post")
 		case ErrCategoryNotFound:
@@ -271,8 +343,292 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success
+	w.Header().Set("ETag", etag(newVersion))
 	responseJSON := map[string]interface{}{
 		"message": "post updated successfully",
+		"data": map[string]interface{}{
+			"id":      postID.String(),
+			"version": newVersion,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetRevisions handles listing every version of a post, oldest first
+func (h *Handler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	revisions, err := h.service.GetRevisions(r.Context(), postID, viewerFromContext(r))
+	if err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		default:
+			log.Printf("GetRevisions error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "revisions retrieved successfully",
+		"data":    revisions,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// GetRevisionDiff handles comparing two versions of a post, given as the from and to
+// revision numbers in the query string
+func (h *Handler) GetRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	// Both default to 0, which the service reads as the current and the previous revision
+	var revisions [2]int
+	for i, name := range []string{"from", "to"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		revisions[i], err = strconv.Atoi(value)
+		if err != nil || revisions[i] < 1 {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid "+name+" revision")
+			return
+		}
+	}
+
+	result, err := h.service.GetRevisionDiff(r.Context(), postID, viewerFromContext(r), revisions[0], revisions[1])
+	if err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case revision.ErrRevisionNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "revision not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		default:
+			log.Printf("GetRevisionDiff error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "revision diff retrieved successfully",
+		"data":    result,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// PublishPost handles publishing a draft or scheduled post, or scheduling it when
+// publish_at is in the future
+func (h *Handler) PublishPost(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	// The body is optional; without it the post is published now
+	var req PublishPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	status, err := h.service.PublishPost(r.Context(), postID, userUUID, req.PublishAt)
+	if err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrAlreadyPublished:
+			response.RespondWithError(w, http.StatusConflict, "post is already published")
+		case ErrUnauthorized:
+			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to publish this post")
+		default:
+			log.Printf("PublishPost error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	message := "post published successfully"
+	data := map[string]interface{}{
+		"id":     postID.String(),
+		"status": status,
+	}
+	if status == models.PostStatusScheduled {
+		message = "post scheduled successfully"
+		data["publish_at"] = req.PublishAt
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": message,
+		"data":    data,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// UnschedulePost handles turning a scheduled post back into a draft
+func (h *Handler) UnschedulePost(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	if err := h.service.UnschedulePost(r.Context(), postID, userUUID); err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrAlreadyPublished:
+			response.RespondWithError(w, http.StatusConflict, "post is already published")
+		case ErrUnauthorized:
+			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to unschedule this post")
+		default:
+			log.Printf("UnschedulePost error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "post moved back to drafts",
+		"data": map[string]string{
+			"id":     postID.String(),
+			"status": models.PostStatusDraft,
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// DeletePost handles soft-deleting a post by its author
+func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	if err := h.service.DeletePost(r.Context(), postID, userUUID); err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
+		case ErrUnauthorized:
+			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to delete this post")
+		default:
+			log.Printf("DeletePost error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "post deleted successfully",
+		"data": map[string]string{
+			"id": postID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// RestorePost handles restoring a soft-deleted post by its author within the restore window
+func (h *Handler) RestorePost(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	if err := h.service.RestorePost(r.Context(), postID, userUUID); err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostNotDeleted:
+			response.RespondWithError(w, http.StatusConflict, "post is not deleted")
+		case ErrRestoreExpired:
+			response.RespondWithError(w, http.StatusGone, "restore window has expired")
+		case ErrUnauthorized:
+			response.RespondWithError(w, http.StatusForbidden, "you are not authorized to restore this post")
+		default:
+			log.Printf("RestorePost error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "post restored successfully",
+		"data": map[string]string{
+			"id": postID.String(),
+		},
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
+
+// HardDeletePost handles permanently removing a post (moderators only)
+func (h *Handler) HardDeletePost(w http.ResponseWriter, r *http.Request) {
+	postID, err := uuid.Parse(r.PathValue("postId"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, "invalid post ID format")
+		return
+	}
+
+	if err := h.service.HardDeletePost(r.Context(), postID); err != nil {
+		switch err {
+		case ErrPostNotFound:
+			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		default:
+			log.Printf("HardDeletePost error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "post permanently deleted",
 		"data": map[string]string{
 			"id": postID.String(),
 		},
@@ -288,16 +644,8 @@ func (h *Handler) VotePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user ID from context
-	userID := r.Context().Value(models.UserContextKey).(string)
-	if userID == "" {
-		response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
-		return
-	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		response.RespondWithError(w, http.StatusBadRequest, "invalid user ID")
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
 		return
 	}
 
@@ -355,6 +703,8 @@ func (h *Handler) VotePost(w http.ResponseWriter, r *http.Request) {
 		switch err {
 		case ErrPostNotFound:
 			response.RespondWithError(w, http.StatusNotFound, "post not found")
+		case ErrPostDeleted:
+			response.RespondWithError(w, http.StatusGone, "post has been deleted")
 		case ErrInvalidVoteType:
 			response.RespondWithError(w, http.StatusBadRequest, "invalid vote type, must be 1 (upvote) or -1 (downvote)")
 		default:
@@ -380,3 +730,106 @@ func (h *Handler) VotePost(w http.ResponseWriter, r *http.Request) {
 	}
 	response.RespondWithJSON(w, http.StatusOK, responseJSON)
 }
+
+// parsePostFilter reads the listing filters from the query string. Categories may be given
+// as repeated or comma-separated category slugs. Dates are RFC 3339 timestamps or plain
+// YYYY-MM-DD dates; a plain to date includes that whole day.
+func parsePostFilter(r *http.Request) (PostFilter, error) {
+	q := r.URL.Query()
+	filter := PostFilter{
+		Author: strings.TrimSpace(q.Get("author")),
+		Sort:   q.Get("sort"),
+		Period: q.Get("period"),
+		Status: q.Get("status"),
+	}
+
+	for _, value := range q["category"] {
+		for _, slug := range strings.Split(value, ",") {
+			if slug = strings.TrimSpace(slug); slug != "" && !slices.Contains(filter.Categories, slug) {
+				filter.Categories = append(filter.Categories, slug)
+			}
+		}
+	}
+
+	if from := q.Get("from"); from != "" {
+		t, err := parseFilterTime(from, false)
+		if err != nil {
+			return filter, errors.New("invalid from date, use RFC 3339 or YYYY-MM-DD")
+		}
+		filter.From = &t
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := parseFilterTime(to, true)
+		if err != nil {
+			return filter, errors.New("invalid to date, use RFC 3339 or YYYY-MM-DD")
+		}
+		filter.To = &t
+	}
+
+	// Fill in defaults here too so the response echoes the filters actually applied
+	if err := filter.normalize(); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseFilterTime parses an RFC 3339 timestamp or a YYYY-MM-DD date. With endOfDay a
+// date is moved to the start of the next day, so an exclusive bound covers the whole day.
+func parseFilterTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// etag formats a post version as an ETag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch reads the post version from an If-Match header holding a single ETag.
+// The wildcard * matches any version and yields 0.
+func parseIfMatch(header string) (int, bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true
+	}
+
+	value, ok := strings.CutPrefix(header, `"`)
+	if !ok {
+		return 0, false
+	}
+	value, ok = strings.CutSuffix(value, `"`)
+	if !ok {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// viewerFromContext returns the signed-in user's ID, or uuid.Nil for anonymous requests,
+// so responses can include the viewer's own votes
+func viewerFromContext(r *http.Request) uuid.UUID {
+	userID, ok := r.Context().Value(models.UserContextKey).(string)
+	if !ok {
+		return uuid.Nil
+	}
+	viewerID, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return viewerID
+}
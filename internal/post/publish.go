@@ -0,0 +1,238 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/thediligencedev/betteridn/internal/mention"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+)
+
+// publishBatchSize is how many due posts PublishDue publishes per transaction
+const publishBatchSize = 100
+
+// validateStatus checks that a new post's status is known and that publishAt is a future
+// time for scheduled posts and absent otherwise
+func validateStatus(status string, publishAt *time.Time) error {
+	switch status {
+	case models.PostStatusDraft, models.PostStatusPublished:
+		if publishAt != nil {
+			return ErrInvalidPublishAt
+		}
+	case models.PostStatusScheduled:
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return ErrInvalidPublishAt
+		}
+	default:
+		return ErrInvalidStatus
+	}
+	return nil
+}
+
+// PublishPost publishes a draft or scheduled post of userID. When publishAt is in the
+// future the post is scheduled for then instead. It returns the resulting status.
+func (s *PostService) PublishPost(ctx context.Context, postID, userID uuid.UUID, publishAt *time.Time) (string, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	post, err := lockOwnPost(ctx, tx, postID, userID)
+	if err != nil {
+		return "", err
+	}
+	if post.deletedAt != nil {
+		return "", ErrPostDeleted
+	}
+	if post.status == models.PostStatusPublished {
+		return "", ErrAlreadyPublished
+	}
+
+	status := models.PostStatusPublished
+	if publishAt != nil && publishAt.After(post.now) {
+		status = models.PostStatusScheduled
+		_, err = tx.Exec(ctx, `
+			UPDATE posts SET status = $1, publish_at = $2 WHERE id = $3
+		`, status, publishAt, postID)
+		if err != nil {
+			return "", fmt.Errorf("failed to schedule post: %w", err)
+		}
+	} else if err = s.publish(ctx, tx, postID, userID, post.content); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return status, nil
+}
+
+// UnschedulePost turns a scheduled post of userID back into a draft
+func (s *PostService) UnschedulePost(ctx context.Context, postID, userID uuid.UUID) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	post, err := lockOwnPost(ctx, tx, postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.deletedAt != nil {
+		return ErrPostDeleted
+	}
+	if post.status == models.PostStatusPublished {
+		return ErrAlreadyPublished
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE posts SET status = $1, publish_at = NULL WHERE id = $2
+	`, models.PostStatusDraft, postID)
+	if err != nil {
+		return fmt.Errorf("failed to unschedule post: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// PublishDue publishes every scheduled post whose publish_at has passed and returns how
+// many it published. Posts are claimed with SKIP LOCKED, so concurrent callers on several
+// instances never publish the same post twice. A post that fails to publish is logged and
+// left scheduled for the next call, so it does not hold up the rest of the queue.
+func (s *PostService) PublishDue(ctx context.Context) (int, error) {
+	published := 0
+	// Not NULL, which would match no post at all
+	failed := []uuid.UUID{}
+	for {
+		n, batchFailed, err := s.publishDueBatch(ctx, failed)
+		published += n
+		failed = append(failed, batchFailed...)
+		if err != nil || n+len(batchFailed) < publishBatchSize {
+			return published, err
+		}
+	}
+}
+
+// publishDueBatch publishes up to publishBatchSize due posts other than skip in one
+// transaction, each under its own savepoint. It returns how many it published and the
+// posts that failed.
+func (s *PostService) publishDueBatch(ctx context.Context, skip []uuid.UUID) (int, []uuid.UUID, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	type duePost struct {
+		ID      uuid.UUID
+		UserID  uuid.UUID
+		Content string
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, user_id, COALESCE(content, '')
+		FROM posts
+		WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+		  AND NOT (id = ANY($2))
+		ORDER BY publish_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, publishBatchSize, skip)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query due posts: %w", err)
+	}
+	due, err := pgx.CollectRows(rows, pgx.RowToStructByPos[duePost])
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to scan due posts: %w", err)
+	}
+
+	var failed []uuid.UUID
+	for _, post := range due {
+		if err := s.publishSavepoint(ctx, tx, post.ID, post.UserID, post.Content); err != nil {
+			log.Printf("Failed to publish scheduled post %s: %v", post.ID, err)
+			failed = append(failed, post.ID)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(due) - len(failed), failed, nil
+}
+
+// publishSavepoint publishes a post under a savepoint of tx, so a failure only undoes
+// this post
+func (s *PostService) publishSavepoint(ctx context.Context, tx pgx.Tx, postID, authorID uuid.UUID, content string) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	defer sp.Rollback(ctx)
+
+	if err := s.publish(ctx, sp, postID, authorID, content); err != nil {
+		return err
+	}
+	if err := sp.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// publish makes a locked draft or scheduled post public. Its creation time becomes the
+// publishing time, so it shows up at the top of listings, and edits made while it was
+// a draft no longer count as edits.
+func (s *PostService) publish(ctx context.Context, tx pgx.Tx, postID, authorID uuid.UUID, content string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE posts
+		SET status = $1, publish_at = NULL, created_at = NOW(), updated_at = NOW(), edited_at = NULL
+		WHERE id = $2
+	`, models.PostStatusPublished, postID)
+	if err != nil {
+		return fmt.Errorf("failed to publish post: %w", err)
+	}
+
+	return s.announce(ctx, tx, postID, authorID, content)
+}
+
+// announce notifies the users mentioned in a newly published post and the author's followers
+func (s *PostService) announce(ctx context.Context, tx pgx.Tx, postID, authorID uuid.UUID, content string) error {
+	if err := s.mentions.Sync(ctx, tx, mention.SubjectPost, postID, postID, authorID, content); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT follower_id FROM follows WHERE followee_id = $1`, authorID)
+	if err != nil {
+		return fmt.Errorf("failed to query followers: %w", err)
+	}
+	followerIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to scan followers: %w", err)
+	}
+
+	for _, followerID := range followerIDs {
+		err = s.notifier.Notify(ctx, tx, notification.NewNotification{
+			UserID:      followerID,
+			FromUserID:  authorID,
+			Type:        notification.TypeNewPost,
+			SubjectType: notification.SubjectPost,
+			SubjectID:   postID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
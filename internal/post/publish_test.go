@@ -0,0 +1,101 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/internal/testdb"
+)
+
+func TestPublishDueSkipsPostsThatFail(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	s := NewPostService(pool, 0, notification.NewNotificationService(pool))
+
+	newUser := func(name string) uuid.UUID {
+		t.Helper()
+		var id uuid.UUID
+		err := pool.QueryRow(ctx, `
+			INSERT INTO users (username, email, password) VALUES ($1, $1 || '@example.com', 'x')
+			RETURNING id
+		`, name).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	failing, other, follower := newUser("failing"), newUser("other"), newUser("follower")
+
+	// Announcing the failing author's post to their follower errors
+	if _, err := pool.Exec(ctx, `INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)`, follower, failing); err != nil {
+		t.Fatal(err)
+	}
+	_, err := pool.Exec(ctx, fmt.Sprintf(`
+		CREATE FUNCTION refuse_notification() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			RAISE EXCEPTION 'notification refused';
+		END $$;
+		CREATE TRIGGER refuse_notification BEFORE INSERT ON notifications
+		FOR EACH ROW WHEN (NEW.user_id = '%s') EXECUTE FUNCTION refuse_notification();
+	`, follower))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failing post is due first, so it would come up first on every run
+	schedule := func(userID uuid.UUID, dueAgo time.Duration) uuid.UUID {
+		t.Helper()
+		publishAt := time.Now().Add(time.Hour)
+		postID, err := s.CreatePost(ctx, userID, "Scheduled", "Hello", nil, models.PostStatusScheduled, &publishAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, `UPDATE posts SET publish_at = NOW() - $1::interval WHERE id = $2`, dueAgo.String(), postID); err != nil {
+			t.Fatal(err)
+		}
+		return postID
+	}
+	failingPost := schedule(failing, 2*time.Minute)
+	otherPost := schedule(other, time.Minute)
+
+	status := func(postID uuid.UUID) string {
+		t.Helper()
+		var status string
+		if err := pool.QueryRow(ctx, `SELECT status FROM posts WHERE id = $1`, postID).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	for run := 0; run < 2; run++ {
+		published, err := s.PublishDue(ctx)
+		if err != nil {
+			t.Fatalf("run %d: PublishDue: %v", run, err)
+		}
+		if want := 1 - run; published != want {
+			t.Fatalf("run %d: published %d posts, want %d", run, published, want)
+		}
+	}
+	if got := status(otherPost); got != models.PostStatusPublished {
+		t.Errorf("post after the failing one is %s, want published", got)
+	}
+	if got := status(failingPost); got != models.PostStatusScheduled {
+		t.Errorf("failing post is %s, want still scheduled", got)
+	}
+
+	// Once the cause is gone, the next run publishes it
+	if _, err := pool.Exec(ctx, `DROP TRIGGER refuse_notification ON notifications`); err != nil {
+		t.Fatal(err)
+	}
+	if published, err := s.PublishDue(ctx); err != nil || published != 1 {
+		t.Fatalf("PublishDue after the fix = %d, %v, want 1", published, err)
+	}
+	if got := status(failingPost); got != models.PostStatusPublished {
+		t.Errorf("failing post is %s after the fix, want published", got)
+	}
+}
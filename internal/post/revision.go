@@ -0,0 +1,67 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/revision"
+)
+
+// postCategoriesQuery selects the sorted category names of the post p
+const postCategoriesQuery = `
+	ARRAY(
+		SELECT c.name
+		FROM post_categories pc
+		JOIN categories c ON pc.category_id = c.id
+		WHERE pc.post_id = p.id
+		ORDER BY c.name
+	)`
+
+// GetRevisions retrieves every version of a post, oldest first. The last one is the
+// current version of the post. Unpublished posts are only found by their author viewerID.
+func (s *PostService) GetRevisions(ctx context.Context, postID, viewerID uuid.UUID) ([]models.Revision, error) {
+	// Read both tables from one snapshot so a concurrent edit cannot show up twice
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	var current models.Revision
+	var visible, deleted bool
+	err = tx.QueryRow(ctx, `
+		SELECT p.title, COALESCE(p.content, ''), COALESCE(p.edited_at, p.created_at),
+			p.status = 'published' OR p.user_id = $2, p.deleted_at IS NOT NULL,
+			`+postCategoriesQuery+`
+		FROM posts p
+		WHERE p.id = $1
+	`, postID, viewerID).Scan(&current.Title, &current.Content, &current.CreatedAt, &visible, &deleted, &current.Categories)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, fmt.Errorf("failed to get post: %w", err)
+	}
+	if !visible {
+		return nil, ErrPostNotFound
+	}
+	if deleted {
+		return nil, ErrPostDeleted
+	}
+
+	return revision.List(ctx, tx, revision.SubjectPost, postID, current)
+}
+
+// GetRevisionDiff compares two versions of a post by revision number. When to is 0 it
+// is the current version, and when from is 0 it is the version before to.
+func (s *PostService) GetRevisionDiff(ctx context.Context, postID, viewerID uuid.UUID, from, to int) (*models.RevisionDiff, error) {
+	revisions, err := s.GetRevisions(ctx, postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return revision.Diff(revisions, from, to)
+}
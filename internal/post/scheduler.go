@@ -0,0 +1,61 @@
+package post
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// schedulerInterval is how often the scheduler looks for posts that are due
+const schedulerInterval = 30 * time.Second
+
+// Scheduler publishes scheduled posts once their publish_at has passed. The schedule is
+// the posts table itself, so posts scheduled before a restart are still published, late
+// if the server was down at the time, and several instances can each run a Scheduler.
+type Scheduler struct {
+	service *PostService
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewScheduler starts a Scheduler publishing through service; stop it with Close
+func NewScheduler(service *PostService) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		service: service,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+// Close stops the scheduler and waits for a publishing run in progress to finish
+func (s *Scheduler) Close() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	// Catch up on posts that became due while the server was down
+	for {
+		published, err := s.service.PublishDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Scheduler publish error: %v", err)
+		}
+		if published > 0 {
+			log.Printf("Scheduler published %d posts", published)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,17 +2,36 @@ package post
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/counter"
+	"github.com/thediligencedev/betteridn/internal/mention"
 	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/internal/revision"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+	"github.com/thediligencedev/betteridn/pkg/markdown"
 )
 
 var (
 	ErrPostNotFound      = errors.New("post not found")
+	ErrPostDeleted       = errors.New("post has been deleted")
+	ErrPostNotDeleted    = errors.New("post is not deleted")
+	ErrRestoreExpired    = errors.New("restore window has expired")
+	ErrVersionMismatch   = errors.New("post has been modified since the given version")
+	ErrInvalidStatus     = errors.New("invalid status, must be one of draft, scheduled, published")
+	ErrInvalidPublishAt  = errors.New("publish_at must be a future time for scheduled posts and omitted otherwise")
+	ErrAlreadyPublished  = errors.New("post is already published")
+	ErrSignInRequired    = errors.New("sign in to list your drafts and scheduled posts")
 	ErrCategoryNotFound  = errors.New("one or more categories not found")
 	ErrUnauthorized      = errors.New("unauthorized to modify this post")
 	ErrInvalidVoteType   = errors.New("invalid vote type, must be 1 (upvote) or -1 (downvote)")
@@ -22,16 +41,44 @@ var (
 	ErrInvalidPagination = errors.New("invalid pagination parameters")
 )
 
+// ChannelPostVotes is the Postgres NOTIFY channel announcing vote count changes.
+// Its payload is a VoteEvent.
+const ChannelPostVotes = "post_votes"
+
+// VoteEvent carries the vote counts of a post after a vote changed them
+type VoteEvent struct {
+	PostID    uuid.UUID        `json:"post_id"`
+	VoteCount models.VoteCount `json:"vote_count"`
+}
+
 type PostService struct {
-	pool *pgxpool.Pool
+	pool          *pgxpool.Pool
+	restoreWindow time.Duration
+	notifier      *notification.NotificationService
+	mentions      *mention.MentionService
 }
 
-func NewPostService(pool *pgxpool.Pool) *PostService {
-	return &PostService{pool: pool}
+// NewPostService creates a PostService. Authors can restore a deleted post
+// for restoreWindow after deleting it.
+func NewPostService(pool *pgxpool.Pool, restoreWindow time.Duration, notifier *notification.NotificationService) *PostService {
+	return &PostService{
+		pool:          pool,
+		restoreWindow: restoreWindow,
+		notifier:      notifier,
+		mentions:      mention.NewMentionService(pool, notifier),
+	}
 }
 
-// CreatePost creates a new post with the given title, content, and categories
-func (s *PostService) CreatePost(ctx context.Context, userID uuid.UUID, title, content string, categories []string) (uuid.UUID, error) {
+// CreatePost creates a new post with the given title, content, and categories. The post is
+// published right away unless status makes it a draft, or schedules it for publishAt.
+func (s *PostService) CreatePost(ctx context.Context, userID uuid.UUID, title, content string, categories []string, status string, publishAt *time.Time) (uuid.UUID, error) {
+	if status == "" {
+		status = models.PostStatusPublished
+	}
+	if err := validateStatus(status, publishAt); err != nil {
+		return uuid.Nil, err
+	}
+
 	// Validate categories exist
 	if err := s.validateCategories(ctx, categories); err != nil {
 		return uuid.Nil, err
@@ -46,10 +93,10 @@ func (s *PostService) CreatePost(ctx context.Context, userID uuid.UUID, title, c
 	// Insert post
 	var postID uuid.UUID
 	err = tx.QueryRow(ctx, `
-		INSERT INTO posts (user_id, title, content, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
+		INSERT INTO posts (user_id, title, content, status, publish_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
 		RETURNING id
-	`, userID, title, content).Scan(&postID)
+	`, userID, title, content, status, publishAt).Scan(&postID)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to create post: %w", err)
 	}
@@ -73,6 +120,13 @@ func (s *PostService) CreatePost(ctx context.Context, userID uuid.UUID, title, c
 		}
 	}
 
+	// Drafts stay private, so mentions and followers are only notified on publishing
+	if status == models.PostStatusPublished {
+		if err = s.announce(ctx, tx, postID, userID, content); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -80,8 +134,23 @@ func (s *PostService) CreatePost(ctx context.Context, userID uuid.UUID, title, c
 	return postID, nil
 }
 
-// GetPosts retrieves a paginated list of posts
-func (s *PostService) GetPosts(ctx context.Context, page, limit int) ([]models.Post, error) {
+// PostPage is one page of a post listing. NextCursor and PrevCursor are empty when
+// there is no page in that direction.
+type PostPage struct {
+	Posts      []models.Post
+	Total      int
+	NextCursor string
+	PrevCursor string
+}
+
+// GetPosts retrieves a page of posts matching filter, along with the total number of
+// matching posts. The page starts at the after cursor when one is given, and at the
+// page-th page of limit posts otherwise. Unless viewerID is uuid.Nil, each post includes
+// the viewer's own vote.
+func (s *PostService) GetPosts(ctx context.Context, filter PostFilter, after string, page, limit int, viewerID uuid.UUID) (*PostPage, error) {
+	if err := filter.normalize(); err != nil {
+		return nil, err
+	}
 	if page < 1 {
 		page = 1
 	}
@@ -89,25 +158,102 @@ func (s *PostService) GetPosts(ctx context.Context, page, limit int) ([]models.P
 		limit = 20
 	}
 
-	offset := (page - 1) * limit
+	var position *cursor.Cursor
+	if after != "" {
+		c, err := cursor.Parse(after)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		position = &c
+	}
+
+	if filter.Status != models.PostStatusPublished {
+		if viewerID == uuid.Nil {
+			return nil, ErrSignInRequired
+		}
+		filter.viewer = viewerID
+	}
+
+	sort := postSorts[filter.Sort]
+	where, args := filter.where(nil)
+
+	var total int
+	err := s.pool.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE `+where, args...).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count posts: %w", err)
+	}
+
+	backward := position != nil && position.Backward
+	offset := 0
+	if position != nil {
+		var keyset string
+		keyset, args = sort.after(*position, args)
+		where += " AND " + keyset
+	} else {
+		offset = (page - 1) * limit
+	}
 
-	// Query posts with user info
+	// Query posts with user info, fetching one extra row to know whether another page follows
 	rows, err := s.pool.Query(ctx, `
-		SELECT p.id, p.title, p.content, p.created_at, p.updated_at, u.username
+		SELECT p.id, p.title, p.content, p.created_at, p.updated_at, u.username,
+			p.upvotes, p.downvotes, p.comment_count, p.status, p.publish_at, p.version, p.edited_at, `+sort.score()+`
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		ORDER BY p.created_at DESC
-		LIMIT $1 OFFSET $2
-	`, limit, offset)
+		WHERE `+where+`
+		ORDER BY `+sort.orderBy(backward)+`
+		LIMIT $`+strconv.Itoa(len(args)+1)+` OFFSET $`+strconv.Itoa(len(args)+2),
+		append(args, limit+1, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query posts: %w", err)
 	}
+
+	posts, scores, err := s.collectPosts(ctx, rows, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts, scores = posts[:limit], scores[:limit]
+	}
+	if backward {
+		slices.Reverse(posts)
+		slices.Reverse(scores)
+	}
+
+	result := &PostPage{Posts: posts, Total: total}
+	if len(posts) == 0 {
+		return result, nil
+	}
+
+	first, last := 0, len(posts)-1
+	// Going backwards there is always a next page: the one the cursor came from
+	if hasMore || backward {
+		result.NextCursor = cursor.After(posts[last].CreatedAt, scores[last], posts[last].ID).String()
+	}
+	if (backward && hasMore) || (!backward && (position != nil || page > 1)) {
+		result.PrevCursor = cursor.Before(posts[first].CreatedAt, scores[first], posts[first].ID).String()
+	}
+
+	return result, nil
+}
+
+// collectPosts scans and closes rows of (id, title, content, created_at, updated_at, username,
+// upvotes, downvotes, comment_count, status, publish_at, version, edited_at, score) and attaches the details of each post for viewerID.
+// It returns the scores separately.
+func (s *PostService) collectPosts(ctx context.Context, rows pgx.Rows, viewerID uuid.UUID) ([]models.Post, []float64, error) {
 	defer rows.Close()
 
 	var posts []models.Post
+	var scores []float64
 	for rows.Next() {
-		var post models.Post
+		post := models.Post{VoteCount: &models.VoteCount{}}
 		var username string
+		var score float64
 
 		err := rows.Scan(
 			&post.ID,
@@ -116,44 +262,98 @@ func (s *PostService) GetPosts(ctx context.Context, page, limit int) ([]models.P
 			&post.CreatedAt,
 			&post.UpdatedAt,
 			&username,
+			&post.VoteCount.Upvotes,
+			&post.VoteCount.Downvotes,
+			&post.CommentCount,
+			&post.Status,
+			&post.PublishAt,
+			&post.Version,
+			&post.EditedAt,
+			&score,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan post row: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan post row: %w", err)
 		}
 
 		post.User = &models.UserBasic{
 			Username: username,
 		}
+		post.Edited = post.EditedAt != nil
 
-		// Get categories for this post
-		post.Categories, err = s.getPostCategories(ctx, post.ID)
-		if err != nil {
-			return nil, err
-		}
+		posts = append(posts, post)
+		scores = append(scores, score)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating post rows: %w", err)
+	}
+
+	if err := s.attachPostDetails(ctx, posts, viewerID); err != nil {
+		return nil, nil, err
+	}
 
-		// Get vote counts for this post
-		post.VoteCount, err = s.getPostVoteCounts(ctx, post.ID)
+	return posts, scores, nil
+}
+
+// attachPostDetails renders the content of posts and loads their categories and mentions,
+// and the vote viewerID cast on each unless viewerID is uuid.Nil. Each detail is loaded for
+// all posts in one query, so the cost does not grow with the number of posts.
+func (s *PostService) attachPostDetails(ctx context.Context, posts []models.Post, viewerID uuid.UUID) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIDs := make([]uuid.UUID, len(posts))
+	contents := make(map[uuid.UUID]string, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+		contents[post.ID] = post.Content
+	}
+
+	categories, err := s.getPostsCategories(ctx, postIDs)
+	if err != nil {
+		return err
+	}
+
+	spans, err := s.mentions.Spans(ctx, mention.SubjectPost, contents)
+	if err != nil {
+		return err
+	}
+
+	var viewerVotes map[uuid.UUID]int
+	if viewerID != uuid.Nil {
+		viewerVotes, err = s.getViewerVotes(ctx, viewerID, postIDs)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		posts = append(posts, post)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating post rows: %w", err)
+	for i := range posts {
+		id := posts[i].ID
+		posts[i].ContentHTML = markdown.Render(posts[i].Content)
+		posts[i].Categories = categories[id]
+		posts[i].Mentions = spans[id]
+		if viewerVotes != nil {
+			vote := viewerVotes[id]
+			posts[i].MyVote = &vote
+		}
 	}
 
-	return posts, nil
+	return nil
 }
 
-// GetPostByID retrieves a post by its ID
-func (s *PostService) GetPostByID(ctx context.Context, postID uuid.UUID) (*models.Post, error) {
-	var post models.Post
+// GetPostByID retrieves a post by its ID. Unless viewerID is uuid.Nil, the post includes
+// the vote viewerID cast on it. Unpublished posts are only found by their author. A
+// deleted post is returned as a tombstone, with its title and content replaced, along
+// with ErrPostDeleted.
+func (s *PostService) GetPostByID(ctx context.Context, postID, viewerID uuid.UUID) (*models.Post, error) {
+	post := models.Post{VoteCount: &models.VoteCount{}}
 	var username string
+	var authorID uuid.UUID
 
 	err := s.pool.QueryRow(ctx, `
-		SELECT p.id, p.title, p.content, p.created_at, p.updated_at, u.username
+		SELECT p.id, p.title, p.content, p.created_at, p.updated_at, p.user_id, u.username,
+			p.upvotes, p.downvotes, p.comment_count, p.status, p.publish_at, p.version, p.edited_at, p.deleted_at
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		WHERE p.id = $1
@@ -163,65 +363,115 @@ func (s *PostService) GetPostByID(ctx context.Context, postID uuid.UUID) (*model
 		&post.Content,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&authorID,
 		&username,
+		&post.VoteCount.Upvotes,
+		&post.VoteCount.Downvotes,
+		&post.CommentCount,
+		&post.Status,
+		&post.PublishAt,
+		&post.Version,
+		&post.EditedAt,
+		&post.DeletedAt,
 	)
 	if err != nil {
 		return nil, ErrPostNotFound
 	}
 
+	if post.Status != models.PostStatusPublished && authorID != viewerID {
+		return nil, ErrPostNotFound
+	}
+
+	if post.DeletedAt != nil {
+		return &models.Post{
+			ID:          post.ID,
+			Title:       models.DeletedPostPlaceholder,
+			Content:     models.DeletedPostPlaceholder,
+			ContentHTML: markdown.Render(models.DeletedPostPlaceholder),
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			IsDeleted:   true,
+			DeletedAt:   post.DeletedAt,
+		}, ErrPostDeleted
+	}
+
 	post.User = &models.UserBasic{
 		Username: username,
 	}
+	post.Edited = post.EditedAt != nil
 
-	// Get categories for this post
-	post.Categories, err = s.getPostCategories(ctx, post.ID)
-	if err != nil {
+	posts := []models.Post{post}
+	if err := s.attachPostDetails(ctx, posts, viewerID); err != nil {
 		return nil, err
 	}
 
-	// Get vote counts for this post
-	post.VoteCount, err = s.getPostVoteCounts(ctx, post.ID)
-	if err != nil {
-		return nil, err
+	return &posts[0], nil
+}
+
+// UpdatePost updates an existing post, keeping its previous version as a revision.
+// The update only applies if the post is still at version, unless version is 0, and
+// returns the post's new version. When the post has moved on, it returns the current
+// version along with ErrVersionMismatch. An update that changes nothing is ignored.
+func (s *PostService) UpdatePost(ctx context.Context, postID, userID uuid.UUID, version int, title, content string, categories []string) (int, error) {
+	// Validate categories exist
+	if err := s.validateCategories(ctx, categories); err != nil {
+		return 0, err
 	}
 
-	return &post, nil
-}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
 
-// UpdatePost updates an existing post
-func (s *PostService) UpdatePost(ctx context.Context, postID, userID uuid.UUID, title, content string, categories []string) error {
-	// Check if post exists and belongs to the user
+	// Check if post exists and belongs to the user, locking it so revisions are numbered in order
 	var postOwnerID uuid.UUID
-	err := s.pool.QueryRow(ctx, `
-		SELECT user_id FROM posts WHERE id = $1
-	`, postID).Scan(&postOwnerID)
+	var currentVersion int
+	var status string
+	var deleted bool
+	var current models.Revision
+	err = tx.QueryRow(ctx, `
+		SELECT p.user_id, p.version, p.status, p.deleted_at IS NOT NULL,
+			p.title, COALESCE(p.content, ''), COALESCE(p.edited_at, p.created_at),
+			`+postCategoriesQuery+`
+		FROM posts p
+		WHERE p.id = $1
+		FOR UPDATE
+	`, postID).Scan(&postOwnerID, &currentVersion, &status, &deleted,
+		&current.Title, &current.Content, &current.CreatedAt, &current.Categories)
 	if err != nil {
-		return ErrPostNotFound
+		return 0, ErrPostNotFound
 	}
 
 	if postOwnerID != userID {
-		return ErrUnauthorized
+		return 0, ErrUnauthorized
 	}
-
-	// Validate categories exist
-	if err := s.validateCategories(ctx, categories); err != nil {
-		return err
+	if deleted {
+		return 0, ErrPostDeleted
+	}
+	if version != 0 && version != currentVersion {
+		return currentVersion, ErrVersionMismatch
 	}
 
-	tx, err := s.pool.Begin(ctx)
+	next := models.Revision{Title: title, Content: content, Categories: categories}
+	changed, err := revision.Save(ctx, tx, revision.SubjectPost, postID, current, next)
 	if err != nil {
-		return ErrInternalServer
+		return 0, err
+	}
+	if !changed {
+		return currentVersion, nil
 	}
-	defer tx.Rollback(ctx)
 
 	// Update post
-	_, err = tx.Exec(ctx, `
+	var newVersion int
+	err = tx.QueryRow(ctx, `
 		UPDATE posts
-		SET title = $1, content = $2, updated_at = $3
+		SET title = $1, content = $2, updated_at = $3, edited_at = $3, version = version + 1
 		WHERE id = $4
-	`, title, content, time.Now(), postID)
+		RETURNING version
+	`, title, content, time.Now(), postID).Scan(&newVersion)
 	if err != nil {
-		return fmt.Errorf("failed to update post: %w", err)
+		return 0, fmt.Errorf("failed to update post: %w", err)
 	}
 
 	// Delete existing post categories
@@ -230,7 +480,7 @@ func (s *PostService) UpdatePost(ctx context.Context, postID, userID uuid.UUID,
 		WHERE post_id = $1
 	`, postID)
 	if err != nil {
-		return fmt.Errorf("failed to delete existing post categories: %w", err)
+		return 0, fmt.Errorf("failed to delete existing post categories: %w", err)
 	}
 
 	// Insert new post categories
@@ -240,7 +490,7 @@ func (s *PostService) UpdatePost(ctx context.Context, postID, userID uuid.UUID,
 			SELECT id FROM categories WHERE name = $1
 		`, categoryName).Scan(&categoryID)
 		if err != nil {
-			return ErrCategoryNotFound
+			return 0, ErrCategoryNotFound
 		}
 
 		_, err = tx.Exec(ctx, `
@@ -248,10 +498,120 @@ func (s *PostService) UpdatePost(ctx context.Context, postID, userID uuid.UUID,
 			VALUES ($1, $2)
 		`, postID, categoryID)
 		if err != nil {
-			return fmt.Errorf("failed to associate post with category: %w", err)
+			return 0, fmt.Errorf("failed to associate post with category: %w", err)
+		}
+	}
+
+	// Only users newly mentioned by this edit are notified; drafts wait until they are published
+	if status == models.PostStatusPublished {
+		if err = s.mentions.Sync(ctx, tx, mention.SubjectPost, postID, postID, userID, content); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return newVersion, nil
+}
+
+// DeletePost soft-deletes a post of userID. The post disappears from listings but keeps
+// its comments and votes, and its author can restore it within the restore window.
+func (s *PostService) DeletePost(ctx context.Context, postID, userID uuid.UUID) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	post, err := lockOwnPost(ctx, tx, postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.deletedAt != nil {
+		return ErrPostDeleted
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE posts SET deleted_at = NOW() WHERE id = $1`, postID)
+	if err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RestorePost undoes DeletePost if the restore window has not ended yet
+func (s *PostService) RestorePost(ctx context.Context, postID, userID uuid.UUID) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	post, err := lockOwnPost(ctx, tx, postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.deletedAt == nil {
+		return ErrPostNotDeleted
+	}
+	if post.now.Sub(*post.deletedAt) > s.restoreWindow {
+		return ErrRestoreExpired
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE posts SET deleted_at = NULL WHERE id = $1`, postID)
+	if err != nil {
+		return fmt.Errorf("failed to restore post: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// HardDeletePost permanently removes a post, deleted or not, along with its comments,
+// votes, revisions, and the mentions and notifications about it or its comments. It is
+// meant for moderators and does not check ownership.
+func (s *PostService) HardDeletePost(ctx context.Context, postID uuid.UUID) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return ErrInternalServer
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the post keeps new comments out until it is gone
+	err = tx.QueryRow(ctx, `SELECT id FROM posts WHERE id = $1 FOR UPDATE`, postID).Scan(&postID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPostNotFound
+		}
+		return fmt.Errorf("failed to lock post: %w", err)
+	}
+
+	// These are keyed by subject rather than referencing the post or its comments, so they
+	// do not cascade
+	for _, table := range []string{"mentions", "notifications", "revisions"} {
+		_, err = tx.Exec(ctx, `
+			DELETE FROM `+table+`
+			WHERE (subject_type = 'post' AND subject_id = $1)
+				OR (subject_type = 'comment' AND subject_id IN (SELECT id FROM comments WHERE post_id = $1))
+		`, postID)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s of post: %w", table, err)
 		}
 	}
 
+	if _, err = tx.Exec(ctx, `DELETE FROM posts WHERE id = $1`, postID); err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -259,30 +619,59 @@ func (s *PostService) UpdatePost(ctx context.Context, postID, userID uuid.UUID,
 	return nil
 }
 
-// VotePost records a vote on a post
+// ownPost is the state of a post locked by lockOwnPost. now is the database time and
+// deletedAt is nil unless the post is deleted.
+type ownPost struct {
+	now       time.Time
+	deletedAt *time.Time
+	status    string
+	content   string
+}
+
+// lockOwnPost locks a post of userID for the rest of tx and returns its state
+func lockOwnPost(ctx context.Context, tx pgx.Tx, postID, userID uuid.UUID) (*ownPost, error) {
+	var ownerID uuid.UUID
+	var post ownPost
+	err := tx.QueryRow(ctx, `
+		SELECT user_id, NOW(), deleted_at, status, COALESCE(content, '') FROM posts WHERE id = $1 FOR UPDATE
+	`, postID).Scan(&ownerID, &post.now, &post.deletedAt, &post.status, &post.content)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, fmt.Errorf("failed to lock post: %w", err)
+	}
+	if ownerID != userID {
+		return nil, ErrUnauthorized
+	}
+	return &post, nil
+}
+
+// VotePost records a vote on a post and updates the post's vote counters
 func (s *PostService) VotePost(ctx context.Context, postID, userID uuid.UUID, voteType int) (*models.VoteResult, error) {
 	// Validate vote type
 	if voteType != 1 && voteType != -1 {
 		return nil, ErrInvalidVoteType
 	}
 
-	// Check if post exists
-	var exists bool
-	err := s.pool.QueryRow(ctx, `
-		SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1)
-	`, postID).Scan(&exists)
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return nil, ErrInternalServer
 	}
-	if !exists {
-		return nil, ErrPostNotFound
-	}
+	defer tx.Rollback(ctx)
 
-	tx, err := s.pool.Begin(ctx)
+	// Check if post exists, locking it so concurrent votes update the counters in order
+	var postOwnerID uuid.UUID
+	var deleted bool
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, deleted_at IS NOT NULL FROM posts WHERE id = $1 AND status = 'published' FOR UPDATE
+	`, postID).Scan(&postOwnerID, &deleted)
 	if err != nil {
-		return nil, ErrInternalServer
+		return nil, ErrPostNotFound
+	}
+	if deleted {
+		return nil, ErrPostDeleted
 	}
-	defer tx.Rollback(ctx)
 
 	// Track if the vote was removed
 	voteRemoved := false
@@ -329,24 +718,105 @@ func (s *PostService) VotePost(ctx context.Context, postID, userID uuid.UUID, vo
 		}
 	}
 
+	newVoteType := voteType
+	if voteRemoved {
+		newVoteType = 0
+	}
+	upDelta, downDelta := counter.VoteDelta(existingVoteType, newVoteType)
+
+	var voteCount models.VoteCount
+	err = tx.QueryRow(ctx, `
+		UPDATE posts
+		SET upvotes = upvotes + $1, downvotes = downvotes + $2, score = score + $1 - $2
+		WHERE id = $3
+		RETURNING upvotes, downvotes
+	`, upDelta, downDelta, postID).Scan(&voteCount.Upvotes, &voteCount.Downvotes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update vote counters: %w", err)
+	}
+
+	// Let the author know about new upvotes
+	if voteType == 1 && !voteRemoved {
+		err = s.notifier.Notify(ctx, tx, notification.NewNotification{
+			UserID:      postOwnerID,
+			FromUserID:  userID,
+			Type:        notification.TypePostLike,
+			SubjectType: notification.SubjectPost,
+			SubjectID:   postID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Get updated vote counts
-	voteCount, err := s.getPostVoteCounts(ctx, postID)
-	if err != nil {
-		return nil, err
+	// The vote is already committed, so a failed broadcast only costs live subscribers an update
+	if err := s.publishVoteEvent(ctx, postID, voteCount); err != nil {
+		log.Printf("VotePost publish error: %v", err)
 	}
 
 	return &models.VoteResult{
-		VoteCount:   *voteCount,
+		VoteCount:   voteCount,
 		VoteRemoved: voteRemoved,
 	}, nil
 }
 
+// GetVoteCounts retrieves vote counts for several posts at once. Posts that do not
+// exist are included with zero counts.
+func (s *PostService) GetVoteCounts(ctx context.Context, postIDs []uuid.UUID) (map[uuid.UUID]*models.VoteCount, error) {
+	counts := make(map[uuid.UUID]*models.VoteCount, len(postIDs))
+	for _, id := range postIDs {
+		counts[id] = &models.VoteCount{}
+	}
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, upvotes, downvotes
+		FROM posts
+		WHERE id = ANY($1)
+	`, postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vote counts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID uuid.UUID
+		var voteCount models.VoteCount
+		if err := rows.Scan(&postID, &voteCount.Upvotes, &voteCount.Downvotes); err != nil {
+			return nil, fmt.Errorf("failed to scan vote counts: %w", err)
+		}
+		counts[postID] = &voteCount
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating vote count rows: %w", err)
+	}
+
+	return counts, nil
+}
+
 // Helper functions
 
+// publishVoteEvent announces new vote counts on ChannelPostVotes
+func (s *PostService) publishVoteEvent(ctx context.Context, postID uuid.UUID, voteCount models.VoteCount) error {
+	payload, err := json.Marshal(VoteEvent{PostID: postID, VoteCount: voteCount})
+	if err != nil {
+		return fmt.Errorf("failed to encode vote event: %w", err)
+	}
+
+	_, err = s.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, ChannelPostVotes, string(payload))
+	if err != nil {
+		return fmt.Errorf("failed to publish vote event: %w", err)
+	}
+	return nil
+}
+
 // validateCategories checks if all categories exist
 func (s *PostService) validateCategories(ctx context.Context, categories []string) error {
 	if len(categories) == 0 {
@@ -368,26 +838,28 @@ func (s *PostService) validateCategories(ctx context.Context, categories []strin
 	return nil
 }
 
-// getPostCategories retrieves categories for a post
-func (s *PostService) getPostCategories(ctx context.Context, postID uuid.UUID) ([]string, error) {
+// getPostsCategories retrieves the category names of several posts, keyed by post ID
+func (s *PostService) getPostsCategories(ctx context.Context, postIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
 	rows, err := s.pool.Query(ctx, `
-		SELECT c.name
+		SELECT pc.post_id, c.name
 		FROM categories c
 		JOIN post_categories pc ON c.id = pc.category_id
-		WHERE pc.post_id = $1
-	`, postID)
+		WHERE pc.post_id = ANY($1)
+		ORDER BY c.name
+	`, postIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query post categories: %w", err)
 	}
 	defer rows.Close()
 
-	var categories []string
+	categories := make(map[uuid.UUID][]string, len(postIDs))
 	for rows.Next() {
+		var postID uuid.UUID
 		var category string
-		if err := rows.Scan(&category); err != nil {
+		if err := rows.Scan(&postID, &category); err != nil {
 			return nil, fmt.Errorf("failed to scan category: %w", err)
 		}
-		categories = append(categories, category)
+		categories[postID] = append(categories[postID], category)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -397,24 +869,32 @@ func (s *PostService) getPostCategories(ctx context.Context, postID uuid.UUID) (
 	return categories, nil
 }
 
-// getPostVoteCounts retrieves vote counts for a post
-func (s *PostService) getPostVoteCounts(ctx context.Context, postID uuid.UUID) (*models.VoteCount, error) {
-	var upvotes, downvotes int
-
-	err := s.pool.QueryRow(ctx, `
-		SELECT 
-			COUNT(CASE WHEN vote_type = 1 THEN 1 END) as upvotes,
-			COUNT(CASE WHEN vote_type = -1 THEN 1 END) as downvotes
+// getViewerVotes retrieves the votes userID cast on several posts, keyed by post ID.
+// Posts the user did not vote on are missing from the map.
+func (s *PostService) getViewerVotes(ctx context.Context, userID uuid.UUID, postIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT post_id, vote_type
 		FROM post_votes
-		WHERE post_id = $1
-	`, postID).Scan(&upvotes, &downvotes)
-
+		WHERE user_id = $1 AND post_id = ANY($2)
+	`, userID, postIDs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get vote counts: %w", err)
+		return nil, fmt.Errorf("failed to query viewer votes: %w", err)
 	}
+	defer rows.Close()
 
-	return &models.VoteCount{
-		Upvotes:   upvotes,
-		Downvotes: downvotes,
-	}, nil
+	votes := make(map[uuid.UUID]int, len(postIDs))
+	for rows.Next() {
+		var postID uuid.UUID
+		var voteType int
+		if err := rows.Scan(&postID, &voteType); err != nil {
+			return nil, fmt.Errorf("failed to scan viewer vote: %w", err)
+		}
+		votes[postID] = voteType
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating viewer vote rows: %w", err)
+	}
+
+	return votes, nil
 }
@@ -0,0 +1,152 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/mention"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/internal/testdb"
+)
+
+// queryCounter counts the queries run through a pool
+type queryCounter struct {
+	queries atomic.Int64
+}
+
+func (c *queryCounter) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	c.queries.Add(1)
+	return ctx
+}
+
+func (c *queryCounter) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+func TestGetPostsQueryCountDoesNotGrowWithPageSize(t *testing.T) {
+	counter := &queryCounter{}
+	pool := testdb.New(t, func(cfg *pgxpool.Config) {
+		cfg.ConnConfig.Tracer = counter
+	})
+	ctx := context.Background()
+	s := NewPostService(pool, 0, notification.NewNotificationService(pool))
+
+	var authorID, viewerID uuid.UUID
+	err := pool.QueryRow(ctx, `
+		INSERT INTO users (username, email, password) VALUES ('author', 'author@example.com', 'x')
+		RETURNING id
+	`).Scan(&authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pool.QueryRow(ctx, `
+		INSERT INTO users (username, email, password) VALUES ('viewer', 'viewer@example.com', 'x')
+		RETURNING id
+	`).Scan(&viewerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO categories (name, slug) VALUES ('Go', 'go'), ('SQL', 'sql')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every post has categories, a mention and a vote by the viewer, so each detail is loaded
+	for i := 0; i < 100; i++ {
+		postID, err := s.CreatePost(ctx, authorID, fmt.Sprintf("Post %d", i), "Hello @viewer", []string{"Go", "SQL"}, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.VotePost(ctx, postID, viewerID, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	countQueries := func(limit int) int64 {
+		t.Helper()
+		before := counter.queries.Load()
+		page, err := s.GetPosts(ctx, PostFilter{}, "", 1, limit, viewerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Posts) != limit {
+			t.Fatalf("got %d posts, want %d", len(page.Posts), limit)
+		}
+		if len(page.Posts[0].Categories) != 2 || len(page.Posts[0].Mentions) != 1 || page.Posts[0].MyVote == nil {
+			t.Fatalf("post details were not loaded: %+v", page.Posts[0])
+		}
+		return counter.queries.Load() - before
+	}
+
+	small, large := countQueries(1), countQueries(100)
+	if small != large {
+		t.Errorf("listing 1 post ran %d queries but listing 100 ran %d", small, large)
+	}
+}
+
+func TestHardDeletePostRemovesMentionsAndNotifications(t *testing.T) {
+	pool := testdb.New(t)
+	ctx := context.Background()
+	s := NewPostService(pool, 0, notification.NewNotificationService(pool))
+
+	var authorID uuid.UUID
+	err := pool.QueryRow(ctx, `
+		INSERT INTO users (username, email, password)
+		VALUES ('author', 'author@example.com', 'x'), ('viewer', 'viewer@example.com', 'x')
+		RETURNING id
+	`).Scan(&authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The viewer is mentioned in both posts and in a comment on the deleted one
+	postID, err := s.CreatePost(ctx, authorID, "Deleted", "Hello @viewer", nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptID, err := s.CreatePost(ctx, authorID, "Kept", "Hello @viewer", nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commentID uuid.UUID
+	err = pool.QueryRow(ctx, `
+		INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, 'Hi @viewer') RETURNING id
+	`, postID, authorID).Scan(&commentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.mentions.Sync(ctx, tx, mention.SubjectComment, commentID, postID, authorID, "Hi @viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.HardDeletePost(ctx, postID); err != nil {
+		t.Fatalf("HardDeletePost: %v", err)
+	}
+
+	for _, table := range []string{"mentions", "notifications"} {
+		rows, err := pool.Query(ctx, `SELECT subject_id FROM `+table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subjects, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subjects) != 1 || subjects[0] != keptID {
+			t.Errorf("%s left for %v, want only the kept post %s", table, subjects, keptID)
+		}
+	}
+
+	if err := s.HardDeletePost(ctx, postID); err != ErrPostNotFound {
+		t.Errorf("HardDeletePost again = %v, want ErrPostNotFound", err)
+	}
+}
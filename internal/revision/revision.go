@@ -0,0 +1,141 @@
+// Package revision keeps the earlier versions of edited posts and comments and compares
+// them. It only knows about the revisions table; callers read and lock the current version
+// of their subject themselves.
+package revision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/pkg/diff"
+)
+
+// Subject types, matching the CHECK constraint on revisions.subject_type
+const (
+	SubjectPost    = "post"
+	SubjectComment = "comment"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Save stores current, the version a post or comment has now, as its next revision before
+// it is replaced by next. It stores nothing and returns false when next is identical;
+// categories are compared as sets. The subject must be locked by tx so revisions are
+// numbered in order.
+func Save(ctx context.Context, tx pgx.Tx, subjectType string, subjectID uuid.UUID, current, next models.Revision) (bool, error) {
+	if current.Title == next.Title && current.Content == next.Content && sameSet(current.Categories, next.Categories) {
+		return false, nil
+	}
+
+	categories := current.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO revisions (subject_type, subject_id, revision, title, content, categories, created_at)
+		SELECT $1, $2, COALESCE(MAX(revision), 0) + 1, $3, $4, $5, $6
+		FROM revisions
+		WHERE subject_type = $1 AND subject_id = $2
+	`, subjectType, subjectID, current.Title, current.Content, categories, current.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save revision: %w", err)
+	}
+	return true, nil
+}
+
+// List retrieves every version of a post or comment, oldest first, ending with current.
+// current should be read in tx as well, from the same snapshot, so a concurrent edit
+// cannot show up twice.
+func List(ctx context.Context, tx pgx.Tx, subjectType string, subjectID uuid.UUID, current models.Revision) ([]models.Revision, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT revision, title, COALESCE(content, ''), categories, created_at
+		FROM revisions
+		WHERE subject_type = $1 AND subject_id = $2
+		ORDER BY revision ASC
+	`, subjectType, subjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var r models.Revision
+		if err := rows.Scan(&r.Revision, &r.Title, &r.Content, &r.Categories, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revision rows: %w", err)
+	}
+
+	current.Current = true
+	current.Revision = len(revisions) + 1
+	if len(revisions) > 0 {
+		current.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+
+	return append(revisions, current), nil
+}
+
+// Diff compares two of revisions, as returned by List, by revision number. When to is 0
+// it is the current version, and when from is 0 it is the version before to.
+func Diff(revisions []models.Revision, from, to int) (*models.RevisionDiff, error) {
+	find := func(number int) (models.Revision, bool) {
+		i := slices.IndexFunc(revisions, func(r models.Revision) bool { return r.Revision == number })
+		if i < 0 {
+			return models.Revision{}, false
+		}
+		return revisions[i], true
+	}
+
+	if to == 0 {
+		to = revisions[len(revisions)-1].Revision
+	}
+	if from == 0 {
+		from = max(to-1, 1)
+	}
+
+	oldRevision, ok := find(from)
+	if !ok {
+		return nil, ErrRevisionNotFound
+	}
+	newRevision, ok := find(to)
+	if !ok {
+		return nil, ErrRevisionNotFound
+	}
+
+	result := &models.RevisionDiff{
+		From:    from,
+		To:      to,
+		Title:   diff.Lines(oldRevision.Title, newRevision.Title),
+		Content: diff.Lines(oldRevision.Content, newRevision.Content),
+	}
+	for _, category := range newRevision.Categories {
+		if !slices.Contains(oldRevision.Categories, category) {
+			result.CategoriesAdded = append(result.CategoriesAdded, category)
+		}
+	}
+	for _, category := range oldRevision.Categories {
+		if !slices.Contains(newRevision.Categories, category) {
+			result.CategoriesRemoved = append(result.CategoriesRemoved, category)
+		}
+	}
+
+	return result, nil
+}
+
+// sameSet reports whether a and b hold the same strings, ignoring order and repeats
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,54 @@
+package revision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thediligencedev/betteridn/internal/models"
+)
+
+func TestDiff(t *testing.T) {
+	revisions := []models.Revision{
+		{Revision: 1, Title: "Title", Content: "a", Categories: []string{"go", "rust"}},
+		{Revision: 2, Title: "Title", Content: "b", Categories: []string{"go", "zig"}},
+		{Revision: 3, Title: "New title", Content: "b", Categories: []string{"go", "zig"}, Current: true},
+	}
+
+	// Defaults to the current version and the one before it
+	got, err := Diff(revisions, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.From != 2 || got.To != 3 {
+		t.Errorf("Diff(0, 0) compared %d to %d, want 2 to 3", got.From, got.To)
+	}
+
+	got, err = Diff(revisions, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.CategoriesAdded, []string{"zig"}) || !reflect.DeepEqual(got.CategoriesRemoved, []string{"rust"}) {
+		t.Errorf("Diff(1, 2) categories = +%v -%v, want +[zig] -[rust]", got.CategoriesAdded, got.CategoriesRemoved)
+	}
+
+	if _, err := Diff(revisions, 1, 4); err != ErrRevisionNotFound {
+		t.Errorf("Diff(1, 4) error = %v, want ErrRevisionNotFound", err)
+	}
+}
+
+func TestSameSet(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, []string{}, true},
+		{[]string{"go", "rust"}, []string{"rust", "go"}, true},
+		{[]string{"go", "go"}, []string{"go"}, true},
+		{[]string{"go"}, []string{"go", "rust"}, false},
+	}
+	for _, tt := range tests {
+		if got := sameSet(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameSet(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
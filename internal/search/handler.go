@@ -0,0 +1,76 @@
+package search
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/pkg/response"
+)
+
+type Handler struct {
+	service *SearchService
+}
+
+func NewHandler(pool *pgxpool.Pool) *Handler {
+	return &Handler{
+		service: NewSearchService(pool),
+	}
+}
+
+// Search handles searching posts and comments
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := Filter{
+		Query:  q.Get("q"),
+		Type:   q.Get("type"),
+		Author: strings.TrimSpace(q.Get("author")),
+	}
+	for _, value := range q["category"] {
+		for _, slug := range strings.Split(value, ",") {
+			if slug = strings.TrimSpace(slug); slug != "" && !slices.Contains(filter.Categories, slug) {
+				filter.Categories = append(filter.Categories, slug)
+			}
+		}
+	}
+
+	// Parse pagination parameters
+	page := 1
+	limit := 20
+
+	if pageStr := q.Get("page"); pageStr != "" {
+		if pageNum, err := strconv.Atoi(pageStr); err == nil && pageNum > 0 {
+			page = pageNum
+		}
+	}
+
+	if limitStr := q.Get("limit"); limitStr != "" {
+		if limitNum, err := strconv.Atoi(limitStr); err == nil && limitNum > 0 && limitNum <= 100 {
+			limit = limitNum
+		}
+	}
+
+	results, total, err := h.service.Search(r.Context(), filter, page, limit)
+	if err != nil {
+		switch err {
+		case ErrEmptyQuery, ErrQueryTooLong, ErrInvalidType:
+			response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("Search error: %v", err)
+			response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// Success
+	responseJSON := map[string]interface{}{
+		"message": "search results retrieved successfully",
+		"data":    results,
+		"total":   total,
+		"page":    page,
+	}
+	response.RespondWithJSON(w, http.StatusOK, responseJSON)
+}
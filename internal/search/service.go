@@ -0,0 +1,221 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/models"
+)
+
+var (
+	ErrEmptyQuery   = errors.New("search query is required")
+	ErrQueryTooLong = errors.New("search query is too long")
+	ErrInvalidType  = errors.New("invalid type, must be one of all, post, comment")
+)
+
+// Kinds of content a search covers
+const (
+	TypeAll     = "all"
+	TypePost    = models.SearchResultPost
+	TypeComment = models.SearchResultComment
+)
+
+// maxQueryLength caps the search query, in characters
+const maxQueryLength = 256
+
+// highlightStart and highlightStop delimit matched terms in ts_headline output. They are
+// private-use characters, removed from the text beforehand, and become <mark> tags once
+// the snippet has been escaped.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var headlineOptions = fmt.Sprintf(
+	`StartSel=%s, StopSel=%s, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`,
+	highlightStart, highlightStop,
+)
+
+var highlighter = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// searchQuery parses the query with web search syntax under both text configurations:
+// quoted phrases, OR, and -word to exclude. Text matches when either parse matches.
+const searchQuery = `
+	WITH q AS (
+		SELECT websearch_to_tsquery('english', $1) AS english,
+			websearch_to_tsquery('indonesian', $1) AS indonesian
+	)
+`
+
+// resultOrder ranks results by relevance, newest first among equals. Posts come before
+// their comments only to make the order total.
+const resultOrder = "h.rank DESC, h.created_at DESC, h.post_id, h.comment_id NULLS FIRST"
+
+// Filter narrows a search. Zero values mean posts and comments from anyone.
+type Filter struct {
+	Query      string   `json:"q"`
+	Type       string   `json:"type"`
+	Categories []string `json:"categories,omitempty"`
+	Author     string   `json:"author,omitempty"`
+}
+
+// normalize fills in defaults and validates the query and type
+func (f *Filter) normalize() error {
+	f.Query = strings.TrimSpace(f.Query)
+	if f.Query == "" {
+		return ErrEmptyQuery
+	}
+	if utf8.RuneCountInString(f.Query) > maxQueryLength {
+		return ErrQueryTooLong
+	}
+
+	if f.Type == "" {
+		f.Type = TypeAll
+	}
+	switch f.Type {
+	case TypeAll, TypePost, TypeComment:
+	default:
+		return ErrInvalidType
+	}
+	return nil
+}
+
+// hits builds a query selecting every post and comment matching the filter, as rows of
+// (type, post_id, comment_id, title, body, username, created_at, rank), appending its
+// parameters to args. Only published posts that are not deleted, and comments on them,
+// are searched. The query must follow searchQuery.
+func (f *Filter) hits(args []any) (string, []any) {
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// Shared by both branches, which alias the post as p and the matching row's author as u
+	conds := []string{"p.deleted_at IS NULL", "p.status = 'published'"}
+	if len(f.Categories) > 0 {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM post_categories pc
+			JOIN categories c ON pc.category_id = c.id
+			WHERE pc.post_id = p.id AND c.slug = ANY(`+param(f.Categories)+`)
+		)`)
+	}
+	if f.Author != "" {
+		conds = append(conds, "u.username = "+param(f.Author))
+	}
+	where := strings.Join(conds, " AND ")
+
+	var branches []string
+	if f.Type != TypeComment {
+		branches = append(branches, `
+			SELECT 'post' AS type, p.id AS post_id, NULL::uuid AS comment_id, p.title,
+				COALESCE(p.content, '') AS body, u.username, p.created_at,
+				ts_rank_cd(p.search_vector, q.english || q.indonesian) AS rank
+			FROM posts p
+			JOIN users u ON p.user_id = u.id
+			CROSS JOIN q
+			WHERE p.search_vector @@ (q.english || q.indonesian) AND `+where)
+	}
+	if f.Type != TypePost {
+		branches = append(branches, `
+			SELECT 'comment' AS type, c.post_id, c.id AS comment_id, p.title,
+				COALESCE(c.content, '') AS body, u.username, c.created_at,
+				ts_rank_cd(c.search_vector, q.english || q.indonesian) AS rank
+			FROM comments c
+			JOIN posts p ON c.post_id = p.id
+			JOIN users u ON c.user_id = u.id
+			CROSS JOIN q
+			WHERE c.search_vector @@ (q.english || q.indonesian) AND c.deleted_at IS NULL AND `+where)
+	}
+
+	return strings.Join(branches, " UNION ALL "), args
+}
+
+type SearchService struct {
+	pool *pgxpool.Pool
+}
+
+func NewSearchService(pool *pgxpool.Pool) *SearchService {
+	return &SearchService{pool: pool}
+}
+
+// Search returns one page of the posts and comments matching filter, most relevant
+// first, along with the total number of matches
+func (s *SearchService) Search(ctx context.Context, filter Filter, page, limit int) ([]models.SearchResult, int, error) {
+	if err := filter.normalize(); err != nil {
+		return nil, 0, err
+	}
+
+	hits, args := filter.hits([]any{filter.Query})
+
+	var total int
+	err := s.pool.QueryRow(ctx, searchQuery+`
+		SELECT COUNT(*) FROM (`+hits+`) h
+	`, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	limitParam, offsetParam := param(limit), param((page-1)*limit)
+	options, markers := param(headlineOptions), param(highlightStart+highlightStop)
+
+	// Snippets are only built for the page, in whichever configuration the text matched
+	rows, err := s.pool.Query(ctx, searchQuery+`
+		SELECT h.type, h.post_id, h.comment_id, h.title, h.username, h.created_at, h.rank,
+			CASE WHEN to_tsvector('indonesian', h.body) @@ q.indonesian
+				THEN ts_headline('indonesian', translate(h.body, `+markers+`, ''), q.indonesian, `+options+`)
+				ELSE ts_headline('english', translate(h.body, `+markers+`, ''), q.english, `+options+`)
+			END
+		FROM (
+			SELECT * FROM (`+hits+`) h
+			ORDER BY `+resultOrder+`
+			LIMIT `+limitParam+` OFFSET `+offsetParam+`
+		) h
+		CROSS JOIN q
+		ORDER BY `+resultOrder+`
+	`, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		var username string
+
+		err := rows.Scan(
+			&result.Type,
+			&result.PostID,
+			&result.CommentID,
+			&result.Title,
+			&username,
+			&result.CreatedAt,
+			&result.Rank,
+			&result.Snippet,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		result.User = &models.UserBasic{Username: username}
+		result.Snippet = highlighter.Replace(html.EscapeString(result.Snippet))
+
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating search result rows: %w", err)
+	}
+
+	return results, total, nil
+}
@@ -3,11 +3,16 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/auth"
 	"github.com/thediligencedev/betteridn/internal/config"
 	"github.com/thediligencedev/betteridn/internal/models"
 	"github.com/thediligencedev/betteridn/pkg/response"
@@ -72,11 +77,67 @@ func WithAuth(sessionManager *scs.SessionManager) Middleware {
 	}
 }
 
+// TrackSessions records activity on signed-in sessions and signs out revoked ones
+// before any route sees them. It must run inside the scs LoadAndSave middleware.
+func TrackSessions(sessions *auth.SessionService) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := sessions.Touch(r.Context(), r); err != nil {
+				slog.Error("Failed to track session", slog.Any("error", err))
+				response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole rejects requests from users whose role is not one of roles.
+// It reads the user ID set by WithAuth, so it must come before WithAuth in a stack.
+// The role is looked up on every request so a demotion takes effect immediately.
+func RequireRole(pool *pgxpool.Pool, roles ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(models.UserContextKey).(string)
+			if !ok || userID == "" {
+				response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			var role string
+			err := pool.QueryRow(r.Context(), `SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					response.RespondWithError(w, http.StatusUnauthorized, "unauthorized")
+					return
+				}
+				slog.Error("Failed to look up user role", slog.String("user_id", userID), slog.Any("error", err))
+				response.RespondWithError(w, http.StatusInternalServerError, "internal server error")
+				return
+			}
+
+			if !slices.Contains(roles, role) {
+				response.RespondWithError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Optional adds the user ID to the context like WithAuth when a session exists,
+// but lets anonymous requests through
 func Optional(sessionManager *scs.SessionManager) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Session is already loaded by scs middleware
-			// This middleware is for semantic purposes only. no-op middleware
+			if userID := sessionManager.GetString(r.Context(), "user_id"); userID != "" {
+				ctx := context.WithValue(r.Context(), models.UserContextKey, userID)
+				r = r.WithContext(ctx)
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -93,8 +154,9 @@ func CORS(cfg *config.Config) Middleware {
 
 			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, hx-current-url, hx-request, hx-target, hx-trigger, Accept, Content-Length, Accept-Encoding, Accept-Language, Credentials")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, hx-current-url, hx-request, hx-target, hx-trigger, Accept, Content-Length, Accept-Encoding, Accept-Language, Credentials, Last-Event-ID, If-Match")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 			if r.Method == http.MethodOptions {
 				w.WriteHeader(http.StatusOK)
@@ -115,3 +177,8 @@ func (w *statusResponseWriter) WriteHeader(code int) {
 	w.statusCode = code
 	w.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush streams
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -1,27 +1,47 @@
 package server
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/thediligencedev/betteridn/internal/auth"
+	"github.com/thediligencedev/betteridn/internal/category"
+	"github.com/thediligencedev/betteridn/internal/comment"
+	"github.com/thediligencedev/betteridn/internal/follow"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
 	"github.com/thediligencedev/betteridn/internal/post"
+	"github.com/thediligencedev/betteridn/internal/search"
+	"github.com/thediligencedev/betteridn/internal/stream"
 )
 
 func (s *Server) registerRoutes(mux *http.ServeMux) {
-	// Initialize Google OAuth
-	auth.InitGoogleOAuth(s.cfg)
-
 	// Initialize handlers
 	confirmationService := auth.NewConfirmationService(s.pool, s.emailWorker)
-	googleHandler := auth.NewGoogleHandler(s.pool, s.sessionManager, s.cfg)
-
-	authHandler := auth.NewHandler(s.pool, s.sessionManager, confirmationService)
-	postHandler := post.NewHandler(s.pool)
+	passwordResetService := auth.NewPasswordResetService(s.pool, s.emailWorker, s.cfg.FrontendURL)
+	twoFactorService := auth.NewTwoFactorService(s.pool, s.sessionManager)
+	passkeyService, err := auth.NewPasskeyService(s.pool, s.sessionManager, s.cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize passkeys: %v", err)
+	}
+	oidcRegistry := auth.NewOIDCRegistry(s.cfg.OIDCProviders)
+	oidcHandler := auth.NewOIDCHandler(s.pool, s.sessionManager, s.sessions, twoFactorService, oidcRegistry, s.cfg)
+
+	authHandler := auth.NewHandler(s.pool, s.sessionManager, confirmationService, passwordResetService, s.sessions, twoFactorService, passkeyService)
+	postHandler := post.NewHandler(s.posts)
+	commentHandler := comment.NewHandler(s.pool, s.cfg.CommentMaxDepth, s.notifications)
+	notificationHandler := notification.NewHandler(s.pool)
+	streamHandler := stream.NewHandler(s.streamBroker, s.notifications, s.posts)
+	followHandler := follow.NewHandler(s.pool, s.notifications)
+	categoryHandler := category.NewHandler(s.pool)
+	searchHandler := search.NewHandler(s.pool)
 
 	// Middleware stacks
 	public := []Middleware{Logger(s.sessionManager), CORS(s.cfg)}
 	protected := []Middleware{Logger(s.sessionManager), WithAuth(s.sessionManager), CORS(s.cfg)}
 	optional := []Middleware{Logger(s.sessionManager), Optional(s.sessionManager), CORS(s.cfg)}
+	moderator := []Middleware{Logger(s.sessionManager), RequireRole(s.pool, models.RoleModerator, models.RoleAdmin), WithAuth(s.sessionManager), CORS(s.cfg)}
+	admin := []Middleware{Logger(s.sessionManager), RequireRole(s.pool, models.RoleAdmin), WithAuth(s.sessionManager), CORS(s.cfg)}
 
 	// Map to track registered OPTIONS patterns
 	registeredOptions := make(map[string]bool)
@@ -39,23 +59,99 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 		}
 	}
 
+	// withProvider serves a route of a fixed identity provider with a provider route's handler
+	withProvider := func(name string, h http.HandlerFunc) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.SetPathValue("provider", name)
+			h(w, r)
+		})
+	}
+
 	// Auth routes
 	register("POST", "/api/v1/auth/signup", http.HandlerFunc(authHandler.SignUp), public)
 	register("POST", "/api/v1/auth/signin", http.HandlerFunc(authHandler.SignIn), public)
 	register("POST", "/api/v1/auth/signout", http.HandlerFunc(authHandler.SignOut), protected)
 	register("GET", "/api/v1/auth/session", http.HandlerFunc(authHandler.GetCurrentSession), protected)
-	register("GET", "/api/v1/auth/google/login", http.HandlerFunc(googleHandler.GoogleLogin), public)
-	register("GET", "/api/v1/auth/google/callback", http.HandlerFunc(googleHandler.GoogleCallback), public)
+	register("GET", "/api/v1/auth/providers", http.HandlerFunc(oidcHandler.GetProviders), public)
+	register("GET", "/api/v1/auth/oidc/{provider}/login", http.HandlerFunc(oidcHandler.Login), public)
+	register("GET", "/api/v1/auth/oidc/{provider}/callback", http.HandlerFunc(oidcHandler.Callback), public)
+	// Google's routes from before providers were configurable, still registered as redirect URLs
+	register("GET", "/api/v1/auth/google/login", withProvider("google", oidcHandler.Login), public)
+	register("GET", "/api/v1/auth/google/callback", withProvider("google", oidcHandler.Callback), public)
 	register("GET", "/api/v1/auth/confirm-email", http.HandlerFunc(authHandler.ConfirmEmail), public)
 	register("POST", "/api/v1/auth/resend-confirmation", http.HandlerFunc(authHandler.ResendConfirmation), protected)
+	register("POST", "/api/v1/auth/forgot-password", http.HandlerFunc(authHandler.ForgotPassword), public)
+	register("POST", "/api/v1/auth/reset-password", http.HandlerFunc(authHandler.ResetPassword), public)
+	register("POST", "/api/v1/auth/change-password", http.HandlerFunc(authHandler.ChangePassword), protected)
+	register("POST", "/api/v1/auth/set-password", http.HandlerFunc(authHandler.SetPassword), protected)
+	register("GET", "/api/v1/auth/sessions", http.HandlerFunc(authHandler.GetSessions), protected)
+	register("DELETE", "/api/v1/auth/sessions", http.HandlerFunc(authHandler.RevokeOtherSessions), protected)
+	register("DELETE", "/api/v1/auth/sessions/{sessionId}", http.HandlerFunc(authHandler.RevokeSession), protected)
+	register("POST", "/api/v1/auth/2fa/setup", http.HandlerFunc(authHandler.SetupTwoFactor), protected)
+	register("POST", "/api/v1/auth/2fa/enable", http.HandlerFunc(authHandler.EnableTwoFactor), protected)
+	register("POST", "/api/v1/auth/2fa/verify", http.HandlerFunc(authHandler.VerifyTwoFactor), public)
+	register("POST", "/api/v1/auth/2fa/disable", http.HandlerFunc(authHandler.DisableTwoFactor), protected)
+	register("POST", "/api/v1/auth/2fa/recovery-codes", http.HandlerFunc(authHandler.RegenerateRecoveryCodes), protected)
+	register("POST", "/api/v1/auth/passkeys/register/begin", http.HandlerFunc(authHandler.BeginPasskeyRegistration), protected)
+	register("POST", "/api/v1/auth/passkeys/register/finish", http.HandlerFunc(authHandler.FinishPasskeyRegistration), protected)
+	register("POST", "/api/v1/auth/passkeys/login/begin", http.HandlerFunc(authHandler.BeginPasskeyLogin), public)
+	register("POST", "/api/v1/auth/passkeys/login/finish", http.HandlerFunc(authHandler.FinishPasskeyLogin), public)
+	register("GET", "/api/v1/auth/passkeys", http.HandlerFunc(authHandler.GetPasskeys), protected)
+	register("PUT", "/api/v1/auth/passkeys/{passkeyId}", http.HandlerFunc(authHandler.RenamePasskey), protected)
+	register("DELETE", "/api/v1/auth/passkeys/{passkeyId}", http.HandlerFunc(authHandler.RemovePasskey), protected)
 
 	// Post routes
 	register("POST", "/api/v1/posts", http.HandlerFunc(postHandler.CreatePost), protected)
 	register("GET", "/api/v1/posts", http.HandlerFunc(postHandler.GetPosts), optional)
 	register("GET", "/api/v1/posts/{postId}", http.HandlerFunc(postHandler.GetPostByID), optional)
 	register("PUT", "/api/v1/posts/{postId}", http.HandlerFunc(postHandler.UpdatePost), protected)
+	register("DELETE", "/api/v1/posts/{postId}", http.HandlerFunc(postHandler.DeletePost), protected)
+	register("GET", "/api/v1/posts/{postId}/revisions", http.HandlerFunc(postHandler.GetRevisions), optional)
+	register("GET", "/api/v1/posts/{postId}/revisions/diff", http.HandlerFunc(postHandler.GetRevisionDiff), optional)
+	register("POST", "/api/v1/posts/{postId}/publish", http.HandlerFunc(postHandler.PublishPost), protected)
+	register("DELETE", "/api/v1/posts/{postId}/publish", http.HandlerFunc(postHandler.UnschedulePost), protected)
+	register("POST", "/api/v1/posts/{postId}/restore", http.HandlerFunc(postHandler.RestorePost), protected)
+	register("DELETE", "/api/v1/posts/{postId}/permanent", http.HandlerFunc(postHandler.HardDeletePost), moderator)
 	register("POST", "/api/v1/posts/{postId}/vote", http.HandlerFunc(postHandler.VotePost), protected)
 
+	register("GET", "/api/v1/feed", http.HandlerFunc(postHandler.GetFeed), protected)
+
+	// Category routes
+	register("GET", "/api/v1/categories", http.HandlerFunc(categoryHandler.GetCategories), optional)
+	register("GET", "/api/v1/categories/{slug}", http.HandlerFunc(categoryHandler.GetCategoryBySlug), optional)
+	register("POST", "/api/v1/categories", http.HandlerFunc(categoryHandler.CreateCategory), admin)
+	register("PUT", "/api/v1/categories/{slug}", http.HandlerFunc(categoryHandler.UpdateCategory), admin)
+	register("POST", "/api/v1/categories/{slug}/merge", http.HandlerFunc(categoryHandler.MergeCategory), admin)
+	register("DELETE", "/api/v1/categories/{slug}", http.HandlerFunc(categoryHandler.DeleteCategory), admin)
+
+	// Comment routes
+	register("POST", "/api/v1/posts/{postId}/comments", http.HandlerFunc(commentHandler.CreateComment), protected)
+	register("GET", "/api/v1/posts/{postId}/comments", http.HandlerFunc(commentHandler.GetComments), optional)
+	register("GET", "/api/v1/posts/{postId}/comments/{commentId}", http.HandlerFunc(commentHandler.GetCommentByID), optional)
+	register("GET", "/api/v1/posts/{postId}/comments/{commentId}/replies", http.HandlerFunc(commentHandler.GetReplies), optional)
+	register("PUT", "/api/v1/posts/{postId}/comments/{commentId}", http.HandlerFunc(commentHandler.UpdateComment), protected)
+	register("DELETE", "/api/v1/posts/{postId}/comments/{commentId}", http.HandlerFunc(commentHandler.DeleteComment), protected)
+	register("POST", "/api/v1/comments/{commentId}/vote", http.HandlerFunc(commentHandler.VoteComment), protected)
+
+	// Notification routes
+	register("GET", "/api/v1/notifications", http.HandlerFunc(notificationHandler.GetNotifications), protected)
+	register("GET", "/api/v1/notifications/unread-count", http.HandlerFunc(notificationHandler.GetUnreadCount), protected)
+	register("POST", "/api/v1/notifications/read-all", http.HandlerFunc(notificationHandler.MarkAllAsRead), protected)
+	register("POST", "/api/v1/notifications/{notificationId}/read", http.HandlerFunc(notificationHandler.MarkAsRead), protected)
+	register("DELETE", "/api/v1/notifications/{notificationId}", http.HandlerFunc(notificationHandler.DeleteNotification), protected)
+
+	// Follow routes
+	register("POST", "/api/v1/users/{username}/follow", http.HandlerFunc(followHandler.Follow), protected)
+	register("DELETE", "/api/v1/users/{username}/follow", http.HandlerFunc(followHandler.Unfollow), protected)
+	register("GET", "/api/v1/users/{username}/followers", http.HandlerFunc(followHandler.GetFollowers), optional)
+	register("GET", "/api/v1/users/{username}/following", http.HandlerFunc(followHandler.GetFollowing), optional)
+
+	// Search
+	register("GET", "/api/v1/search", http.HandlerFunc(searchHandler.Search), optional)
+
+	// Real-time stream
+	register("GET", "/api/v1/stream", http.HandlerFunc(streamHandler.Stream), protected)
+
 	MountSwaggerDocs(mux)
 
 	// Protected example - redirect to frontend
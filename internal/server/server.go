@@ -9,7 +9,11 @@ import (
 	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/auth"
 	"github.com/thediligencedev/betteridn/internal/config"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/internal/post"
+	"github.com/thediligencedev/betteridn/internal/stream"
 	"github.com/thediligencedev/betteridn/internal/worker"
 )
 
@@ -17,8 +21,13 @@ type Server struct {
 	pool           *pgxpool.Pool
 	cfg            *config.Config
 	sessionManager *scs.SessionManager
+	sessions       *auth.SessionService
 	httpServer     *http.Server
 	emailWorker    *worker.EmailWorker
+	streamBroker   *stream.Broker
+	notifications  *notification.NotificationService
+	posts          *post.PostService
+	postScheduler  *post.Scheduler
 }
 
 func New(pool *pgxpool.Pool, cfg *config.Config) *Server {
@@ -31,6 +40,9 @@ func New(pool *pgxpool.Pool, cfg *config.Config) *Server {
 	sessionManager.Cookie.Secure = false
 	sessionManager.Cookie.Path = "/"
 
+	// Track signed-in sessions so users can list and revoke them
+	sessions := auth.NewSessionService(pool, sessionManager)
+
 	// Initialize email worker
 	emailWorker := worker.NewEmailWorker(
 		cfg.SMTPHost,
@@ -40,17 +52,32 @@ func New(pool *pgxpool.Pool, cfg *config.Config) *Server {
 		cfg.SMTPPass,
 	)
 
+	// Initialize the real-time event broker
+	streamBroker := stream.NewBroker(pool)
+
+	// Shared by the handlers and the scheduler
+	notifications := notification.NewNotificationService(pool)
+	posts := post.NewPostService(pool, cfg.PostRestoreWindow, notifications)
+
+	// Publish scheduled posts in the background
+	postScheduler := post.NewScheduler(posts)
+
 	s := &Server{
 		pool:           pool,
 		cfg:            cfg,
 		sessionManager: sessionManager,
+		sessions:       sessions,
 		emailWorker:    emailWorker,
+		streamBroker:   streamBroker,
+		notifications:  notifications,
+		posts:          posts,
+		postScheduler:  postScheduler,
 	}
 
 	mux := http.NewServeMux()
 	s.registerRoutes(mux)
 
-	handler := sessionManager.LoadAndSave(mux)
+	handler := sessionManager.LoadAndSave(TrackSessions(sessions)(mux))
 
 	s.httpServer = &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.ServerPort),
@@ -67,6 +94,9 @@ func (s *Server) Start() error {
 func (s *Server) Shutdown(ctx context.Context) error {
 	log.Println("Stopping HTTP server...")
 	s.emailWorker.Close()
+	// Ends open event streams, which would otherwise keep Shutdown waiting
+	s.streamBroker.Close()
+	s.postScheduler.Close()
 	return s.httpServer.Shutdown(ctx)
 }
 
@@ -0,0 +1,248 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/internal/post"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+)
+
+var ErrBrokerClosed = errors.New("stream broker is closed")
+
+// Event names sent to clients
+const (
+	EventNotification = "notification"
+	EventVote         = "vote"
+	EventHeartbeat    = "heartbeat"
+)
+
+const (
+	subscriberBuffer = 32
+	reconnectDelay   = 2 * time.Second
+)
+
+// Event is a single server-sent event. ID is only set for events a client can resume from.
+type Event struct {
+	ID   string
+	Name string
+	Data []byte
+}
+
+// Subscriber receives the events for one connected client
+type Subscriber struct {
+	userID uuid.UUID
+	posts  map[uuid.UUID]struct{}
+	events chan Event
+}
+
+// Events is closed when the subscriber is removed, falls behind or the broker shuts down
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Broker listens to Postgres NOTIFY channels on a dedicated connection and fans the
+// events out to the subscribers of this instance. Because every instance listens to
+// the same channels, events published by any instance reach every client.
+type Broker struct {
+	pool          *pgxpool.Pool
+	notifications *notification.NotificationService
+
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+	closed      bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewBroker constructs a Broker and starts listening in the background
+func NewBroker(pool *pgxpool.Pool) *Broker {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Broker{
+		pool:          pool,
+		notifications: notification.NewNotificationService(pool),
+		subscribers:   make(map[*Subscriber]struct{}),
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+	go b.run(ctx)
+	return b
+}
+
+// Subscribe registers a client for its own notifications and the vote counts of postIDs
+func (b *Broker) Subscribe(userID uuid.UUID, postIDs []uuid.UUID) (*Subscriber, error) {
+	sub := &Subscriber{
+		userID: userID,
+		posts:  make(map[uuid.UUID]struct{}, len(postIDs)),
+		events: make(chan Event, subscriberBuffer),
+	}
+	for _, id := range postIDs {
+		sub.posts[id] = struct{}{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe removes a client and closes its event channel
+func (b *Broker) Unsubscribe(sub *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Close stops listening and disconnects every subscriber so open streams end
+func (b *Broker) Close() {
+	b.cancel()
+	<-b.done
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// run keeps a listener connection alive until the broker is closed
+func (b *Broker) run(ctx context.Context) {
+	defer close(b.done)
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Stream listener error, reconnecting: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// listen takes a connection out of the pool, LISTENs on every channel and dispatches
+// notifications until the connection fails or ctx is cancelled
+func (b *Broker) listen(ctx context.Context) error {
+	pooled, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// Hijack so a connection in LISTEN state never goes back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	for _, channel := range []string{notification.ChannelNotifications, post.ChannelPostVotes} {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		b.dispatch(ctx, n)
+	}
+}
+
+// dispatch turns a Postgres notification into an Event for the matching subscribers
+func (b *Broker) dispatch(ctx context.Context, n *pgconn.Notification) {
+	switch n.Channel {
+	case notification.ChannelNotifications:
+		var payload notification.ChannelPayload
+		if err := json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+			log.Printf("Stream invalid notification payload: %v", err)
+			return
+		}
+		if !b.hasSubscriber(func(sub *Subscriber) bool { return sub.userID == payload.UserID }) {
+			return
+		}
+
+		stored, err := b.notifications.GetNotification(ctx, payload.ID)
+		if err != nil {
+			log.Printf("Stream failed to load notification %s: %v", payload.ID, err)
+			return
+		}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			log.Printf("Stream failed to encode notification %s: %v", payload.ID, err)
+			return
+		}
+
+		b.broadcast(Event{
+			ID:   cursor.After(stored.CreatedAt, 0, stored.ID).String(),
+			Name: EventNotification,
+			Data: data,
+		}, func(sub *Subscriber) bool { return sub.userID == payload.UserID })
+
+	case post.ChannelPostVotes:
+		var payload post.VoteEvent
+		if err := json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+			log.Printf("Stream invalid vote payload: %v", err)
+			return
+		}
+
+		b.broadcast(Event{
+			Name: EventVote,
+			Data: []byte(n.Payload),
+		}, func(sub *Subscriber) bool {
+			_, ok := sub.posts[payload.PostID]
+			return ok
+		})
+	}
+}
+
+// hasSubscriber reports whether any subscriber matches
+func (b *Broker) hasSubscriber(match func(*Subscriber) bool) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscribers {
+		if match(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast delivers an event to every matching subscriber without blocking. A subscriber
+// too slow to drain its buffer is removed instead of missing the event, so its client
+// reconnects and resumes from the last event it received. Removal happens under the same
+// lock so no later event reaches it first.
+func (b *Broker) broadcast(ev Event, match func(*Subscriber) bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if !match(sub) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			log.Printf("Stream subscriber buffer full, disconnecting user %s", sub.userID)
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thediligencedev/betteridn/internal/models"
+	"github.com/thediligencedev/betteridn/internal/notification"
+	"github.com/thediligencedev/betteridn/internal/post"
+	"github.com/thediligencedev/betteridn/pkg/cursor"
+	"github.com/thediligencedev/betteridn/pkg/response"
+)
+
+const (
+	heartbeatInterval = 25 * time.Second
+	maxSubscribedPost = 100
+	resumePageSize    = 100
+)
+
+type Handler struct {
+	broker        *Broker
+	notifications *notification.NotificationService
+	posts         *post.PostService
+}
+
+func NewHandler(broker *Broker, notifications *notification.NotificationService, posts *post.PostService) *Handler {
+	return &Handler{
+		broker:        broker,
+		notifications: notifications,
+		posts:         posts,
+	}
+}
+
+// Stream handles GET /api/v1/stream?posts=<id>,<id>
+// It pushes the user's new notifications and vote count changes for the listed posts
+// as server-sent events. A reconnecting client sends Last-Event-ID and receives the
+// notifications it missed; vote counts are re-sent as a snapshot on every connect.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	userUUID, ok := models.UserIDFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	postIDs, err := parsePostIDs(r.URL.Query().Get("posts"))
+	if err != nil {
+		response.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// EventSource sends the header itself; the query parameter is for clients that cannot
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		if c, err := cursor.Parse(lastEventID); err != nil || c.Backward {
+			response.RespondWithError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// Subscribe before catching up so nothing published in between is lost
+	sub, err := h.broker.Subscribe(userUUID, postIDs)
+	if err != nil {
+		response.RespondWithError(w, http.StatusServiceUnavailable, "server is shutting down")
+		return
+	}
+	defer h.broker.Unsubscribe(sub)
+
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+
+	// Replay missed notifications a page at a time until caught up, remembering them to
+	// skip duplicates from the live feed
+	sent := make(map[string]struct{})
+	for after := lastEventID; after != ""; {
+		missed, err := h.notifications.GetNotificationsSince(ctx, userUUID, after, resumePageSize)
+		if err != nil {
+			log.Printf("Stream resume error: %v", err)
+			return
+		}
+		for _, n := range missed {
+			data, err := json.Marshal(n)
+			if err != nil {
+				log.Printf("Stream encode error: %v", err)
+				return
+			}
+			ev := Event{ID: cursor.After(n.CreatedAt, 0, n.ID).String(), Name: EventNotification, Data: data}
+			sent[ev.ID] = struct{}{}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			after = ev.ID
+		}
+		if len(missed) < resumePageSize {
+			break
+		}
+	}
+
+	// Current vote counts, so the client starts from a consistent state
+	if len(postIDs) > 0 {
+		counts, err := h.posts.GetVoteCounts(ctx, postIDs)
+		if err != nil {
+			log.Printf("Stream vote snapshot error: %v", err)
+			return
+		}
+		for _, id := range postIDs {
+			data, err := json.Marshal(post.VoteEvent{PostID: id, VoteCount: *counts[id]})
+			if err != nil {
+				log.Printf("Stream encode error: %v", err)
+				return
+			}
+			if err := writeEvent(w, Event{Name: EventVote, Data: data}); err != nil {
+				return
+			}
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		log.Printf("Stream flush error: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				// Broker shut down or this client fell behind; it reconnects and resumes
+				return
+			}
+			if ev.ID != "" {
+				if _, dup := sent[ev.ID]; dup {
+					continue
+				}
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		case t := <-heartbeat.C:
+			data, _ := json.Marshal(map[string]time.Time{"time": t.UTC()})
+			if err := writeEvent(w, Event{Name: EventHeartbeat, Data: data}); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes ev in the text/event-stream format. Data must be a single line.
+func writeEvent(w http.ResponseWriter, ev Event) error {
+	var sb strings.Builder
+	if ev.ID != "" {
+		sb.WriteString("id: " + ev.ID + "\n")
+	}
+	sb.WriteString("event: " + ev.Name + "\n")
+	sb.WriteString("data: ")
+	sb.Write(ev.Data)
+	sb.WriteString("\n\n")
+
+	_, err := w.Write([]byte(sb.String()))
+	return err
+}
+
+// parsePostIDs parses a comma-separated list of post IDs
+func parsePostIDs(raw string) ([]uuid.UUID, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxSubscribedPost {
+		return nil, fmt.Errorf("cannot subscribe to more than %d posts", maxSubscribedPost)
+	}
+
+	seen := make(map[uuid.UUID]struct{}, len(parts))
+	ids := make([]uuid.UUID, 0, len(parts))
+	for _, part := range parts {
+		id, err := uuid.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid post ID format: %s", part)
+		}
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
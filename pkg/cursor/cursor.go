@@ -0,0 +1,81 @@
+// Package cursor encodes keyset positions into opaque strings for paginated lists. Every
+// list uses the same Cursor format; lists ordered by time alone leave Score at zero, and
+// lists that only page forward reject Backward cursors.
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a keyset position for lists that can be paged in both directions. Lists
+// ordered by time use Time, ranked lists use Score; ID is always the tie-breaker.
+// Backward marks a cursor pointing at the page before the position.
+type Cursor struct {
+	Time     time.Time
+	Score    float64
+	ID       uuid.UUID
+	Backward bool
+}
+
+// After returns a cursor for the page following the row at t/score/id
+func After(t time.Time, score float64, id uuid.UUID) Cursor {
+	return Cursor{Time: t, Score: score, ID: id}
+}
+
+// Before returns a cursor for the page preceding the row at t/score/id
+func Before(t time.Time, score float64, id uuid.UUID) Cursor {
+	return Cursor{Time: t, Score: score, ID: id, Backward: true}
+}
+
+// String encodes the cursor into an opaque string accepted by Parse
+func (c Cursor) String() string {
+	direction := "n"
+	if c.Backward {
+		direction = "p"
+	}
+	raw := strings.Join([]string{
+		direction,
+		c.Time.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(c.Score, 'g', -1, 64),
+		c.ID.String(),
+	}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Parse reverses Cursor.String
+func Parse(c string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 || (parts[0] != "n" && parts[0] != "p") {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	score, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{Time: t, Score: score, ID: id, Backward: parts[0] == "p"}, nil
+}
@@ -0,0 +1,112 @@
+package diff
+
+import "strings"
+
+// maxAlignCells bounds the table align fills, len(a)*len(b) after the shared start and end
+// are trimmed, to about 8 MB. Larger changes are shown as one block of deleted lines
+// followed by the inserted ones.
+const maxAlignCells = 1 << 20
+
+// Operations of a diff line
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Line is one line of a diff: unchanged, only in the new text, or only in the old text
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns a line-by-line diff turning oldText into newText. Deleted lines come
+// before the inserted lines that replace them. When the changed part of both texts is too
+// large to align, all of it is shown as deleted and then inserted.
+func Lines(oldText, newText string) []Line {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+
+	// Lines shared at the start and end need no alignment, which keeps the table small
+	// for the typical edit touching a few lines
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Op: OpEqual, Text: text})
+	}
+	lines = append(lines, align(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: OpEqual, Text: text})
+	}
+	return lines
+}
+
+// align diffs a and b along their longest common subsequence, or replaces a with b
+// wholesale when the table would exceed maxAlignCells
+func align(a, b []string) []Line {
+	if len(a) > 0 && len(b) > maxAlignCells/len(a) {
+		lines := make([]Line, 0, len(a)+len(b))
+		for _, text := range a {
+			lines = append(lines, Line{Op: OpDelete, Text: text})
+		}
+		for _, text := range b {
+			lines = append(lines, Line{Op: OpInsert, Text: text})
+		}
+		return lines
+	}
+
+	// lcs(i, j) is the length of the longest common subsequence of a[i:] and b[j:], kept
+	// in one flat table
+	width := len(b) + 1
+	table := make([]int32, (len(a)+1)*width)
+	lcs := func(i, j int) int32 { return table[i*width+j] }
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i*width+j] = lcs(i+1, j+1) + 1
+			} else {
+				table[i*width+j] = max(lcs(i+1, j), lcs(i, j+1))
+			}
+		}
+	}
+
+	var lines []Line
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, Line{Op: OpEqual, Text: a[i]})
+			i++
+			j++
+		case lcs(i+1, j) >= lcs(i, j+1):
+			lines = append(lines, Line{Op: OpDelete, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: OpInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, Line{Op: OpDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, Line{Op: OpInsert, Text: b[j]})
+	}
+	return lines
+}
+
+// splitLines splits text into lines, treating CRLF like LF. An empty text has no lines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
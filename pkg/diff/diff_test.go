@@ -0,0 +1,54 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	got := Lines("a\nb\nc\nd", "a\nx\nc\nd\ne")
+	want := []Line{
+		{Op: OpEqual, Text: "a"},
+		{Op: OpDelete, Text: "b"},
+		{Op: OpInsert, Text: "x"},
+		{Op: OpEqual, Text: "c"},
+		{Op: OpEqual, Text: "d"},
+		{Op: OpInsert, Text: "e"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %v, want %v", got, want)
+	}
+}
+
+func TestLinesTooLargeToAlign(t *testing.T) {
+	numbered := func(prefix string, n int) string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("%s%d", prefix, i)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	// Shared first and last lines are still found when the middle is not aligned
+	oldText := "start\n" + numbered("old", 5000) + "\nend"
+	newText := "start\n" + numbered("new", 5000) + "\nend"
+	got := Lines(oldText, newText)
+
+	if len(got) != 10002 {
+		t.Fatalf("got %d lines, want 10002", len(got))
+	}
+	if got[0] != (Line{Op: OpEqual, Text: "start"}) || got[len(got)-1] != (Line{Op: OpEqual, Text: "end"}) {
+		t.Errorf("shared lines not kept: first %v, last %v", got[0], got[len(got)-1])
+	}
+	for i, line := range got[1 : len(got)-1] {
+		want := OpDelete
+		if i >= 5000 {
+			want = OpInsert
+		}
+		if line.Op != want {
+			t.Fatalf("line %d is %s, want %s", i+1, line.Op, want)
+		}
+	}
+}
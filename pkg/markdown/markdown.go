@@ -0,0 +1,153 @@
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// cacheSize is how many rendered bodies are kept, least recently used first out
+const cacheSize = 4096
+
+// linkRel marks links in user content as neither endorsed by the site nor worth following
+const linkRel = "nofollow ugc"
+
+var (
+	// converter renders CommonMark with GFM tables and strikethrough. Raw HTML in the source
+	// is left out rather than passed through.
+	converter = goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+		),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(util.Prioritized(linkTransformer{}, 100)),
+		),
+	)
+
+	policy = newPolicy()
+	cache  = newLRU(cacheSize)
+)
+
+// Render converts Markdown source into sanitized HTML. Output is cached by the hash of
+// source, so rendering the same body again is a map lookup.
+func Render(source string) string {
+	key := sha256.Sum256([]byte(source))
+	if html, ok := cache.get(key); ok {
+		return html
+	}
+
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(source), &buf); err != nil {
+		// Only writing to buf can fail, which a bytes.Buffer never does
+		return ""
+	}
+	html := policy.Sanitize(buf.String())
+
+	cache.add(key, html)
+	return html
+}
+
+// newPolicy returns the allowlist for rendered HTML: the elements goldmark produces for
+// the enabled syntax, with links and images restricted to web and mail URLs
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "blockquote", "pre",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"em", "strong", "del", "code",
+		"ul", "ol", "li",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + linkRel + `$`)).OnElements("a")
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	// Backstop for links that reach the sanitizer without linkRel
+	p.RequireNoFollowOnLinks(true)
+
+	return p
+}
+
+// linkTransformer sets linkRel on every link and autolink
+type linkTransformer struct{}
+
+func (linkTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindLink, ast.KindAutoLink:
+			n.SetAttributeString("rel", []byte(linkRel))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// lru is a fixed-size cache of rendered HTML keyed by source hash
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is most recently used
+	items map[[sha256.Size]byte]*list.Element
+}
+
+type lruEntry struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		order: list.New(),
+		items: make(map[[sha256.Size]byte]*list.Element, size),
+	}
+}
+
+func (c *lru) get(key [sha256.Size]byte) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).html, true
+}
+
+func (c *lru) add(key [sha256.Size]byte, html string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, html: html})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
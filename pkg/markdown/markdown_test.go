@@ -0,0 +1,110 @@
+package markdown
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestRenderStripsUnsafeURLs(t *testing.T) {
+	tests := []string{
+		"[click](javascript:alert(1))",
+		"[click](JavaScript:alert(1))",
+		"[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+		"![pic](javascript:alert(1))",
+		"![pic](data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=)",
+		"<javascript:alert(1)>",
+	}
+	for _, source := range tests {
+		// The link text may remain, but not as a link target or image source
+		html := Render(source)
+		if strings.Contains(html, "href=") || strings.Contains(html, "src=") {
+			t.Errorf("Render(%q) = %q, want the URL stripped", source, html)
+		}
+	}
+
+	// Web URLs are kept
+	if html := Render("![pic](https://example.com/a.png)"); !strings.Contains(html, `src="https://example.com/a.png"`) {
+		t.Errorf("Render() = %q, want the image source kept", html)
+	}
+}
+
+func TestRenderDropsRawHTML(t *testing.T) {
+	tests := []string{
+		"<script>alert(1)</script>",
+		"Hello <script>alert(1)</script> world",
+		"Hello <b onclick=\"alert(1)\">world</b>",
+		"<div><iframe src=\"https://example.com\"></iframe></div>",
+		"<img src=x onerror=alert(1)>",
+	}
+	for _, source := range tests {
+		html := Render(source)
+		for _, tag := range []string{"<script", "<b", "<div", "<iframe", "<img", "onclick", "onerror"} {
+			if strings.Contains(html, tag) {
+				t.Errorf("Render(%q) = %q, want no %s", source, html, tag)
+			}
+		}
+	}
+}
+
+func TestRenderLinksAreNofollow(t *testing.T) {
+	source := "[inline](https://example.com) <https://example.org> [ref][1] [mail](mailto:a@example.com)\n\n[1]: https://example.net\n"
+	html := Render(source)
+
+	links := strings.Count(html, "<a ")
+	if links != 4 {
+		t.Fatalf("Render() = %q, want 4 links", html)
+	}
+	if got := strings.Count(html, `rel="nofollow ugc"`); got != links {
+		t.Errorf("Render() = %q, want rel=\"nofollow ugc\" on every link", html)
+	}
+}
+
+func TestRenderGFM(t *testing.T) {
+	html := Render("| a | b |\n| :- | -: |\n| 1 | 2 |\n\n~~gone~~\n")
+
+	for _, want := range []string{
+		"<table>",
+		`<th align="left">a</th>`,
+		`<td align="right">2</td>`,
+		"<del>gone</del>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Render() = %q, want it to contain %q", html, want)
+		}
+	}
+}
+
+func TestRenderCachesBySource(t *testing.T) {
+	source := "cached *body*"
+	first := Render(source)
+
+	// A second render of the same source is served from the cache, not rendered again
+	key := sha256.Sum256([]byte(source))
+	if html, ok := cache.get(key); !ok || html != first {
+		t.Fatalf("cache.get() = %q, %v, want %q, true", html, ok, first)
+	}
+	cache.items[key].Value.(*lruEntry).html = "from cache"
+	if got := Render(source); got != "from cache" {
+		t.Errorf("Render() = %q, want the cached HTML", got)
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRU(2)
+	a, b, d := sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b")), sha256.Sum256([]byte("d"))
+
+	c.add(a, "a")
+	c.add(b, "b")
+	c.get(a)
+	c.add(d, "d")
+
+	if _, ok := c.get(b); ok {
+		t.Error("b is still cached, want it evicted")
+	}
+	for _, key := range [][sha256.Size]byte{a, d} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%x was evicted, want it cached", key[:4])
+		}
+	}
+}